@@ -6,6 +6,10 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/nnxmxni/gophersocial/internals/auth"
+	"github.com/nnxmxni/gophersocial/internals/clientip"
+	"github.com/nnxmxni/gophersocial/internals/mailer"
+	"github.com/nnxmxni/gophersocial/internals/pubsub"
+	"github.com/nnxmxni/gophersocial/internals/ranking"
 	"github.com/nnxmxni/gophersocial/internals/ratelimiter"
 	"github.com/nnxmxni/gophersocial/internals/store"
 	"github.com/nnxmxni/gophersocial/internals/store/cache"
@@ -23,17 +27,32 @@ type application struct {
 	cacheStorage  cache.Storage
 	logger        *zap.SugaredLogger
 	authenticator auth.Authenticator
-	rateLimiter   ratelimiter.Limiter
+	rateLimiters  map[string]ratelimiter.Limiter
+	mailer        mailer.Mailer
+	ipResolver    *clientip.Resolver
+	broker        pubsub.Broker
 }
 
 type config struct {
-	addr          string
-	OTPExpiration time.Duration
-	dbConfig      dbConfig
-	mail          mailConfig
-	auth          authConfig
-	redisCfg      redisConfig
-	rateLimiter   ratelimiter.Config
+	addr        string
+	frontendURL string
+	// trustedProxies are the CIDRs whose forwarding headers are believed
+	// when resolving the client IP.
+	trustedProxies []string
+	// forwardedHeader is the one forwarding header the trusted proxies
+	// write, the others are passed through from the client.
+	forwardedHeader string
+	OTPExpiration   time.Duration
+	dbConfig        dbConfig
+	mail            mailConfig
+	auth            authConfig
+	redisCfg        redisConfig
+	rateLimiter     ratelimiter.Config
+	janitor         janitorConfig
+	scheduler       schedulerConfig
+	stream          streamConfig
+	timeline        timelineConfig
+	feedRanking     feedRankingConfig
 }
 
 type redisConfig struct {
@@ -48,13 +67,57 @@ type authConfig struct {
 }
 
 type tokenConfig struct {
-	secret string
-	exp    time.Duration
-	host   string
+	secret     string
+	exp        time.Duration
+	refreshExp time.Duration
+	host       string
+	keysDir    string
+	activeKey  string
 }
 
 type mailConfig struct {
-	OTPExpiration time.Duration
+	OTPExpiration           time.Duration
+	PasswordResetExpiration time.Duration
+	mailer                  mailer.Config
+}
+
+type streamConfig struct {
+	// heartbeat is how often an idle stream gets a comment line, which
+	// keeps proxies from closing it and notices clients that went away.
+	heartbeat time.Duration
+}
+
+// timelineConfig sizes the feeds precomputed in Redis when it is enabled.
+type timelineConfig struct {
+	size int
+	ttl  time.Duration
+	// fanoutMaxFollowers is the follower count past which the posts of an
+	// author are pulled into feeds at read time instead of pushed on write.
+	fanoutMaxFollowers int
+}
+
+type feedRankingConfig struct {
+	weights ranking.Weights
+	// window and candidates bound the posts that are scored, the newest
+	// candidates posts of the last window from the accounts followed and as
+	// many from the second degree ones.
+	window     time.Duration
+	candidates int
+}
+
+type janitorConfig struct {
+	enabled  bool
+	interval time.Duration
+	// unverifiedGracePeriod is how long never activated accounts are kept,
+	// they are not removed at all when it is zero.
+	unverifiedGracePeriod time.Duration
+}
+
+type schedulerConfig struct {
+	enabled  bool
+	interval time.Duration
+	// batchSize is how many due posts are published per query.
+	batchSize int
 }
 
 type dbConfig struct {
@@ -69,19 +132,26 @@ func (app *application) mount() http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(app.ClientIPMiddleware)
+	r.Use(app.RedactTokenMiddleware)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(app.RateLimiterMiddleware)
 
-	r.Use(middleware.Timeout(60 * time.Second))
+	// every group is bounded by timeout but the streams, which are mounted
+	// without it to stay open for as long as the client is there
+	timeout := middleware.Timeout(60 * time.Second)
+
+	r.With(timeout, app.RateLimitByMethod).Get("/.well-known/jwks.json", app.jwksHandler)
 
 	r.Route("/v1", func(r chi.Router) {
-		r.Get("/health", app.healthCheckHandler)
+		r.With(timeout, app.RateLimitByMethod).Get("/health", app.healthCheckHandler)
 
 		r.Route("/post", func(r chi.Router) {
 
+			r.Use(timeout)
+			r.Use(app.RateLimiterMiddleware(policyClient))
 			r.Use(app.EnsureAuthMiddleware)
+			r.Use(app.RateLimitByMethod)
 
 			r.Post("/create", app.createPostHandler)
 
@@ -92,32 +162,161 @@ func (app *application) mount() http.Handler {
 				r.Get("/show", app.getPostHandler)
 				r.Patch("/update", app.EnsurePostOwnership("moderator", app.updatePostHandler))
 				r.Delete("/delete", app.EnsurePostOwnership("admin", app.deletePostHandler))
+
+				r.Get("/revisions", app.EnsurePostOwnership("moderator", app.getPostRevisionsHandler))
+				r.Post("/revisions/{revisionID}/restore", app.EnsureRole("admin", app.restorePostRevisionHandler))
+
+				r.Route("/reactions/{kind}", func(r chi.Router) {
+					r.Put("/", app.addReactionHandler)
+					r.Delete("/", app.removeReactionHandler)
+				})
+
+				r.Route("/comments", func(r chi.Router) {
+					r.Post("/", app.createCommentHandler)
+
+					r.Route("/{commentID}", func(r chi.Router) {
+
+						r.Use(app.commentsContextMiddleware)
+
+						r.Patch("/", app.EnsureCommentOwnership("moderator", app.updateCommentHandler))
+						r.Delete("/", app.EnsureCommentOwnership("admin", app.deleteCommentHandler))
+					})
+				})
 			})
 		})
 
 		r.Route("/users", func(r chi.Router) {
 
-			r.Put("/activate/{token}", app.activateUserHandler)
+			r.Group(func(r chi.Router) {
+				r.Use(timeout)
+				r.Use(app.RateLimiterMiddleware(policyStrict))
+
+				r.Put("/activate/{token}", app.activateUserHandler)
+				r.Post("/activation/resend", app.resendActivationHandler)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(timeout)
+				r.Use(app.RateLimiterMiddleware(policyClient))
+				r.Use(app.EnsureAuthMiddleware)
+				r.Use(app.RateLimitByMethod)
+
+				r.Get("/me", app.getMeHandler)
+				r.Patch("/me", app.updateMeHandler)
+				r.Get("/by-username/{username}", app.getUserByUsernameHandler)
+				r.Get("/me/follow-requests", app.getFollowRequestsHandler)
+				r.Get("/me/drafts", app.getDraftsHandler)
+				r.Put("/me/follow-requests/{requesterID}/approve", app.approveFollowRequestHandler)
+				r.Put("/me/follow-requests/{requesterID}/reject", app.rejectFollowRequestHandler)
+			})
 
 			r.Route("/{userID}", func(r chi.Router) {
 
+				r.Use(timeout)
+				r.Use(app.RateLimiterMiddleware(policyClient))
 				r.Use(app.EnsureAuthMiddleware)
+				r.Use(app.RateLimitByMethod)
+				r.Use(app.userContextMiddleware)
 
 				r.Get("/", app.getUserHandler)
+				r.Get("/followers", app.getFollowersHandler)
+				r.Get("/following", app.getFollowingHandler)
 				r.Put("/follow", app.followUserHandler)
 				r.Put("/unfollow", app.unfollowUserHandler)
+				r.Put("/block", app.blockUserHandler)
+				r.Delete("/block", app.unblockUserHandler)
+				r.Put("/mute", app.muteUserHandler)
+				r.Delete("/mute", app.unmuteUserHandler)
 			})
 
 			r.Group(func(r chi.Router) {
+				r.Use(app.RateLimiterMiddleware(policyClient))
 				r.Use(app.EnsureAuthMiddleware)
+				r.Use(app.RateLimitByMethod)
+
+				r.With(timeout).Get("/feed", app.getUserFeedHandler)
+				r.Get("/feed/stream", app.feedStreamHandler)
+			})
+		})
+
+		r.Route("/conversations", func(r chi.Router) {
+
+			r.Use(app.RateLimiterMiddleware(policyClient))
+			r.Use(app.WebSocketTokenMiddleware)
+			r.Use(app.EnsureAuthMiddleware)
+			r.Use(app.RateLimitByMethod)
+
+			r.Get("/ws", app.conversationsSocketHandler)
+
+			r.Group(func(r chi.Router) {
+				r.Use(timeout)
 
-				r.Get("/feed", app.getUserFeedHandler)
+				r.Get("/", app.getConversationsHandler)
+				r.Post("/", app.createConversationHandler)
+
+				r.Route("/{conversationID}", func(r chi.Router) {
+
+					r.Use(app.conversationContextMiddleware)
+
+					r.Get("/", app.getConversationHandler)
+					r.Get("/messages", app.getMessagesHandler)
+					r.Post("/messages", app.sendMessageHandler)
+					r.Post("/read", app.markConversationReadHandler)
+				})
 			})
 		})
 
+		r.Route("/search", func(r chi.Router) {
+
+			r.Use(timeout)
+			r.Use(app.RateLimiterMiddleware(policyClient))
+			r.Use(app.EnsureAuthMiddleware)
+			r.Use(app.RateLimitByMethod)
+
+			r.Get("/posts", app.searchPostsHandler)
+			r.Get("/users", app.searchUsersHandler)
+		})
+
+		r.Route("/tags", func(r chi.Router) {
+
+			r.Use(timeout)
+			r.Use(app.RateLimiterMiddleware(policyClient))
+			r.Use(app.EnsureAuthMiddleware)
+			r.Use(app.RateLimitByMethod)
+
+			r.Get("/trending", app.getTrendingTagsHandler)
+			r.Get("/{tag}/posts", app.getTagPostsHandler)
+		})
+
+		r.Route("/notifications", func(r chi.Router) {
+
+			r.Use(timeout)
+			r.Use(app.RateLimiterMiddleware(policyClient))
+			r.Use(app.EnsureAuthMiddleware)
+			r.Use(app.RateLimitByMethod)
+
+			r.Get("/", app.getNotificationsHandler)
+			r.Post("/read", app.markNotificationsReadHandler)
+		})
+
 		r.Group(func(r chi.Router) {
+			r.Use(timeout)
+			r.Use(app.RateLimiterMiddleware(policyStrict))
+
 			r.Post("/register", app.registerUserHandler)
 			r.Post("/login", app.loginUserHandler)
+			r.Post("/token/refresh", app.refreshTokenHandler)
+			r.Post("/password/forgot", app.forgotPasswordHandler)
+			r.Post("/password/reset", app.resetPasswordHandler)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(timeout)
+			r.Use(app.RateLimiterMiddleware(policyClient))
+			r.Use(app.EnsureAuthMiddleware)
+			r.Use(app.RateLimitByMethod)
+
+			r.Post("/logout", app.logoutUserHandler)
 		})
 	})
 
@@ -136,6 +335,23 @@ func (app *application) run(mux http.Handler) error {
 
 	shutdown := make(chan error)
 
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	if app.config.janitor.enabled && app.config.janitor.interval > 0 {
+		go app.runJanitor(jobsCtx)
+	}
+
+	if app.config.scheduler.enabled && app.config.scheduler.interval > 0 && app.config.scheduler.batchSize > 0 {
+		go app.runScheduler(jobsCtx)
+	}
+
+	go func() {
+		if err := app.broker.Run(jobsCtx); err != nil {
+			app.logger.Errorw("pubsub broker stopped", "error", err.Error())
+		}
+	}()
+
 	go func() {
 		quit := make(chan os.Signal, 1)
 
@@ -144,6 +360,8 @@ func (app *application) run(mux http.Handler) error {
 
 		app.logger.Infof("Received signal %s, shutting down the server", s.String())
 
+		stopJobs()
+
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 		defer cancel()
 
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/go-playground/validator/v10"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/nnxmxni/gophersocial/internals/auth"
+	"github.com/nnxmxni/gophersocial/internals/mailer"
 	"github.com/nnxmxni/gophersocial/internals/store"
 	"github.com/nnxmxni/gophersocial/types"
 	"github.com/nnxmxni/gophersocial/utils"
@@ -16,8 +20,10 @@ import (
 )
 
 type RegisterUserPayload struct {
-	Email    string `json:"email" validate:"required,email,max=255"`
-	Password string `json:"password" validate:"required,min=8,max=72"`
+	Email       string `json:"email" validate:"required,email,max=255"`
+	Username    string `json:"username" validate:"required,username"`
+	DisplayName string `json:"display_name" validate:"max=100"`
+	Password    string `json:"password" validate:"required,min=8,max=72"`
 }
 
 type LoginUserPayload struct {
@@ -25,6 +31,10 @@ type LoginUserPayload struct {
 	Password string `json:"password" validate:"required,min=8,max=72"`
 }
 
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
 type UserWithToken struct {
 	*store.User
 	Token string `json:"token"`
@@ -61,7 +71,9 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	user := &store.User{
-		Email: payload.Email,
+		Email:       payload.Email,
+		Username:    payload.Username,
+		DisplayName: payload.DisplayName,
 		Role: store.Roles{
 			Name: "user",
 		},
@@ -74,26 +86,53 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 
 	plainToken := uuid.New().String()
 
-	// hash the token for storage but keep the plain token for email
-	hash := sha256.Sum256([]byte(plainToken))
-	hashToken := hex.EncodeToString(hash[:])
+	ctx := r.Context()
 
-	if err := app.store.Users.CreateAndInvite(r.Context(), user, hashToken, app.config.mail.OTPExpiration); err != nil {
-		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
-		return
+	// hash the token for storage but keep the plain token for email
+	err := app.store.Users.CreateAndInvite(ctx, user, hashToken(plainToken), app.config.mail.OTPExpiration, func(user *store.User) error {
+		return app.sendActivationEmail(ctx, user, plainToken)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicateEmail), errors.Is(err, store.ErrDuplicateUsername):
+			_ = app.WriteError(w, r, http.StatusConflict, err)
+			return
+		default:
+			_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
 	}
 
 	_ = app.WriteJSON(w, r, http.StatusCreated, types.APIResponseBody{
 		Status:  true,
-		Message: "User registered successfully",
+		Message: "User registered successfully, check your email to activate your account",
 		Data: map[string]interface{}{
-			"token": plainToken,
-			"user":  user,
+			"user": user,
 		},
 	})
 	return
 }
 
+func (app *application) sendActivationEmail(ctx context.Context, user *store.User, plainToken string) error {
+
+	data := struct {
+		Email         string
+		ActivationURL string
+		ExpiresIn     string
+	}{
+		Email:         user.Email,
+		ActivationURL: fmt.Sprintf("%s/confirm/%s", app.config.frontendURL, plainToken),
+		ExpiresIn:     fmt.Sprintf("%d hours", int(app.config.mail.OTPExpiration.Hours())),
+	}
+
+	if err := app.mailer.Send(ctx, mailer.UserWelcomeTemplate, user.Email, data); err != nil {
+		app.logger.Errorw("error sending activation email", "email", user.Email, "error", err.Error())
+		return err
+	}
+
+	return nil
+}
+
 func (app *application) loginUserHandler(w http.ResponseWriter, r *http.Request) {
 
 	var payload LoginUserPayload
@@ -142,28 +181,142 @@ func (app *application) loginUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	token, err := app.authenticator.GenerateToken(
-		jwt.MapClaims{
-			"sub": user.ID,
-			"exp": time.Now().Add(app.config.auth.token.exp).Unix(),
-			"iat": time.Now().Unix(),
-			"nbf": time.Now().Unix(),
-			"iss": app.config.auth.token.host,
-			"aud": app.config.auth.token.host,
-		},
-	)
+	token, refreshToken, err := app.issueTokens(r.Context(), user.ID, uuid.New().String())
 	if err != nil {
 		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
 	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
-		Status:  true,
-		Message: "Welcome back",
-		Token:   token,
+		Status:       true,
+		Message:      "Welcome back",
+		Token:        token,
+		RefreshToken: refreshToken,
 		Data: map[string]interface{}{
 			"user": user,
 		},
 	})
 	return
 }
+
+func (app *application) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload RefreshTokenPayload
+	if err := utils.ParseJSON(w, r, &payload); err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(&payload); err != nil {
+		_ = app.WriteError(w, r, http.StatusUnprocessableEntity, errors.New("refresh_token is required"))
+		return
+	}
+
+	plainRefreshToken := uuid.New().String()
+
+	next := &store.RefreshToken{
+		Token:     hashToken(plainRefreshToken),
+		ExpiredAt: time.Now().Add(app.config.auth.token.refreshExp),
+	}
+
+	if err := app.store.RefreshTokens.Rotate(r.Context(), hashToken(payload.RefreshToken), next); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound), errors.Is(err, store.ErrRefreshTokenReused):
+			_ = app.WriteError(w, r, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		default:
+			_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	token, err := app.generateAccessToken(next.UserID, next.FamilyID)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:       true,
+		Message:      "Token refreshed successfully",
+		Token:        token,
+		RefreshToken: plainRefreshToken,
+	})
+	return
+}
+
+func (app *application) logoutUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	if err := app.store.RefreshTokens.RevokeFamily(r.Context(), getSessionFromContext(r)); err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "Logged out successfully",
+	})
+	return
+}
+
+// issueTokens starts a new refresh token in the given family and returns it
+// in plain form together with a matching access token.
+func (app *application) issueTokens(ctx context.Context, userID int64, familyID string) (string, string, error) {
+
+	plainRefreshToken := uuid.New().String()
+
+	refreshToken := &store.RefreshToken{
+		Token:     hashToken(plainRefreshToken),
+		UserID:    userID,
+		FamilyID:  familyID,
+		ExpiredAt: time.Now().Add(app.config.auth.token.refreshExp),
+	}
+
+	if err := app.store.RefreshTokens.Create(ctx, refreshToken); err != nil {
+		return "", "", err
+	}
+
+	token, err := app.generateAccessToken(userID, familyID)
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, plainRefreshToken, nil
+}
+
+func (app *application) generateAccessToken(userID int64, familyID string) (string, error) {
+	return app.authenticator.GenerateToken(
+		jwt.MapClaims{
+			"sub": userID,
+			"sid": familyID,
+			"exp": time.Now().Add(app.config.auth.token.exp).Unix(),
+			"iat": time.Now().Unix(),
+			"nbf": time.Now().Unix(),
+			"iss": app.config.auth.token.host,
+			"aud": app.config.auth.token.host,
+		},
+	)
+}
+
+func (app *application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+
+	publisher, ok := app.authenticator.(auth.KeyPublisher)
+	if !ok {
+		_ = app.WriteError(w, r, http.StatusNotFound, store.ErrNotFound)
+		return
+	}
+
+	// served as a bare JWK set, which is what JWKS clients expect
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(publisher.JWKS()); err != nil {
+		app.logger.Errorw(err.Error(), "path", r.URL.Path, "method", r.Method)
+	}
+}
+
+func hashToken(plainToken string) string {
+	hash := sha256.Sum256([]byte(plainToken))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"github.com/nnxmxni/gophersocial/internals/store"
+	"github.com/nnxmxni/gophersocial/types"
+	"net/http"
+)
+
+func (app *application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := getUserFromContext(r)
+	toBeBlockedUser := getProfileFromContext(r)
+
+	if err := app.store.Blocks.Block(r.Context(), user.ID, toBeBlockedUser.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrSelfBlock):
+			_ = app.WriteError(w, r, http.StatusConflict, err)
+			return
+		default:
+			_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	// blocking removed the follows between them
+	app.invalidateTimelines(r.Context(), user.ID, toBeBlockedUser.ID)
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "User blocked successfully",
+	})
+	return
+}
+
+func (app *application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := getUserFromContext(r)
+	toBeUnblockedUser := getProfileFromContext(r)
+
+	if err := app.store.Blocks.Unblock(r.Context(), user.ID, toBeUnblockedUser.ID); err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "User unblocked successfully",
+	})
+	return
+}
+
+func (app *application) muteUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := getUserFromContext(r)
+	toBeMutedUser := getProfileFromContext(r)
+
+	if err := app.store.Mutes.Mute(r.Context(), user.ID, toBeMutedUser.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrSelfMute):
+			_ = app.WriteError(w, r, http.StatusConflict, err)
+			return
+		default:
+			_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	app.invalidateTimelines(r.Context(), user.ID)
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "User muted successfully",
+	})
+	return
+}
+
+func (app *application) unmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := getUserFromContext(r)
+	toBeUnmutedUser := getProfileFromContext(r)
+
+	if err := app.store.Mutes.Unmute(r.Context(), user.ID, toBeUnmutedUser.ID); err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	app.invalidateTimelines(r.Context(), user.ID)
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "User unmuted successfully",
+	})
+	return
+}
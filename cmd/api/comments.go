@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/nnxmxni/gophersocial/internals/store"
+	"github.com/nnxmxni/gophersocial/types"
+	"github.com/nnxmxni/gophersocial/utils"
+	"net/http"
+	"strconv"
+)
+
+type commentKey string
+
+const commentCtx commentKey = "comment"
+
+type createCommentPayload struct {
+	Content string `json:"content" validate:"required,max=1000"`
+}
+
+type updateCommentPayload struct {
+	Content string `json:"content" validate:"required,max=1000"`
+}
+
+func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload createCommentPayload
+
+	if err := utils.ParseJSON(w, r, &payload); err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(&payload); err != nil {
+		var validationErrors validator.ValidationErrors
+		var errorMessages []string
+		message := ""
+		if errors.As(err, &validationErrors) {
+			for _, value := range validationErrors {
+				switch value.Tag() {
+				case "required":
+					message = fmt.Sprintf("%s is %s", value.Field(), value.Tag())
+					errorMessages = append(errorMessages, message)
+				default:
+					message = fmt.Sprintf("The %s is invalid", value.Field())
+					errorMessages = append(errorMessages, message)
+				}
+			}
+		}
+
+		_ = app.WriteError(w, r, http.StatusUnprocessableEntity, errors.New(errorMessages[0]))
+		return
+	}
+
+	user := getUserFromContext(r)
+
+	comment := &store.Comment{
+		PostID:  getPostFromCtx(r).ID,
+		UserID:  user.ID,
+		Content: payload.Content,
+		User:    store.User{ID: user.ID, Username: user.Username},
+	}
+
+	ctx := r.Context()
+	if err := app.store.Comment.Create(ctx, comment); err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	app.notify(ctx, &store.Notification{
+		UserID:    getPostFromCtx(r).UserID,
+		ActorID:   user.ID,
+		Kind:      store.NotificationComment,
+		PostID:    &comment.PostID,
+		CommentID: &comment.ID,
+	})
+	app.notifyMentions(ctx, &store.Notification{
+		ActorID:   user.ID,
+		PostID:    &comment.PostID,
+		CommentID: &comment.ID,
+	}, comment.Content)
+
+	if err := app.WriteJSON(w, r, http.StatusCreated, types.APIResponseBody{
+		Status:  true,
+		Message: "Comment created successfully",
+		Data:    comment,
+	}); err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+}
+
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+
+	comment := getCommentFromCtx(r)
+
+	var payload updateCommentPayload
+
+	if err := utils.ParseJSON(w, r, &payload); err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(&payload); err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	comment.Content = payload.Content
+
+	if err := app.store.Comment.Update(r.Context(), comment); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			_ = app.WriteError(w, r, http.StatusNotFound, err)
+			return
+		default:
+			_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if err := app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "Comment updated successfully",
+		Data:    comment,
+	}); err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+}
+
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+
+	comment := getCommentFromCtx(r)
+
+	if err := app.store.Comment.Delete(r.Context(), comment.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			_ = app.WriteError(w, r, http.StatusNotFound, err)
+			return
+		default:
+			_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if err := app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "Comment deleted successfully",
+	}); err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+}
+
+func (app *application) commentsContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		commentIDAsStr := chi.URLParam(r, "commentID")
+		commentIDAsInt, err := strconv.ParseInt(commentIDAsStr, 10, 64)
+		if err != nil {
+			_ = app.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("invalid comment id - %s", commentIDAsStr))
+			return
+		}
+
+		ctx := r.Context()
+		comment, err := app.store.Comment.GetByID(ctx, commentIDAsInt)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				_ = app.WriteError(w, r, http.StatusNotFound, err)
+				return
+			default:
+				_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		// a comment is only reachable through the post it belongs to
+		if comment.PostID != getPostFromCtx(r).ID {
+			_ = app.WriteError(w, r, http.StatusNotFound, store.ErrNotFound)
+			return
+		}
+
+		ctx = context.WithValue(ctx, commentCtx, comment)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getCommentFromCtx(r *http.Request) *store.Comment {
+	comment, _ := r.Context().Value(commentCtx).(*store.Comment)
+	return comment
+}
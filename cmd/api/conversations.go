@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/nnxmxni/gophersocial/internals/pubsub"
+	"github.com/nnxmxni/gophersocial/internals/store"
+	"github.com/nnxmxni/gophersocial/types"
+	"github.com/nnxmxni/gophersocial/utils"
+	"net/http"
+	"strconv"
+)
+
+type conversationKey string
+
+const conversationCtx conversationKey = "conversation"
+
+type createConversationPayload struct {
+	UserID int64 `json:"user_id" validate:"required,gt=0"`
+}
+
+type sendMessagePayload struct {
+	Content string `json:"content" validate:"required,max=2000"`
+}
+
+type markConversationReadPayload struct {
+	MessageID int64 `json:"message_id" validate:"gte=0"`
+}
+
+// readReceipt is pushed to the other participants when a user reads a
+// conversation.
+type readReceipt struct {
+	ConversationID    int64 `json:"conversation_id"`
+	UserID            int64 `json:"user_id"`
+	LastReadMessageID int64 `json:"last_read_message_id"`
+}
+
+func (app *application) createConversationHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload createConversationPayload
+
+	if err := utils.ParseJSON(w, r, &payload); err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(&payload); err != nil {
+		var validationErrors validator.ValidationErrors
+		var errorMessages []string
+		message := ""
+		if errors.As(err, &validationErrors) {
+			for _, value := range validationErrors {
+				switch value.Tag() {
+				case "required":
+					message = fmt.Sprintf("%s is %s", value.Field(), value.Tag())
+					errorMessages = append(errorMessages, message)
+				default:
+					message = fmt.Sprintf("The %s is invalid", value.Field())
+					errorMessages = append(errorMessages, message)
+				}
+			}
+		}
+
+		_ = app.WriteError(w, r, http.StatusUnprocessableEntity, errors.New(errorMessages[0]))
+		return
+	}
+
+	conversation, created, err := app.store.Conversations.GetOrCreateDirect(r.Context(), getUserFromContext(r).ID, payload.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			_ = app.WriteError(w, r, http.StatusNotFound, err)
+			return
+		case errors.Is(err, store.ErrSelfMessage):
+			_ = app.WriteError(w, r, http.StatusConflict, err)
+			return
+		case errors.Is(err, store.ErrBlocked), errors.Is(err, store.ErrMessagingNotAllowed):
+			_ = app.WriteError(w, r, http.StatusForbidden, err)
+			return
+		default:
+			_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	status, message := http.StatusOK, "Conversation retrieved successfully"
+	if created {
+		status, message = http.StatusCreated, "Conversation created successfully"
+	}
+
+	_ = app.WriteJSON(w, r, status, types.APIResponseBody{
+		Status:  true,
+		Message: message,
+		Data:    conversation,
+	})
+	return
+}
+
+func (app *application) getConversationsHandler(w http.ResponseWriter, r *http.Request) {
+
+	cq := store.PaginatedConversationQuery{
+		Limit: 20,
+	}
+
+	cq, err := cq.Parse(r)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err = utils.Validate.Struct(cq); err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	conversations, err := app.store.Conversations.GetForUser(r.Context(), getUserFromContext(r).ID, cq)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	nextCursor := ""
+	if len(conversations) == cq.Limit {
+		last := conversations[len(conversations)-1]
+		nextCursor = store.Cursor{CreatedAt: last.UpdatedAt, ID: last.ID}.Encode()
+	}
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "Conversations retrieved successfully",
+		Data: map[string]interface{}{
+			"conversations": conversations,
+			"next_cursor":   nextCursor,
+		},
+	})
+	return
+}
+
+func (app *application) getConversationHandler(w http.ResponseWriter, r *http.Request) {
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "Conversation retrieved successfully",
+		Data:    getConversationFromCtx(r),
+	})
+	return
+}
+
+func (app *application) getMessagesHandler(w http.ResponseWriter, r *http.Request) {
+
+	cq := store.PaginatedConversationQuery{
+		Limit: 50,
+	}
+
+	cq, err := cq.Parse(r)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err = utils.Validate.Struct(cq); err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	messages, err := app.store.Conversations.GetMessages(r.Context(), getConversationFromCtx(r).ID, cq)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	nextCursor := ""
+	if len(messages) == cq.Limit {
+		last := messages[len(messages)-1]
+		nextCursor = store.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "Messages retrieved successfully",
+		Data: map[string]interface{}{
+			"messages":    messages,
+			"next_cursor": nextCursor,
+		},
+	})
+	return
+}
+
+func (app *application) sendMessageHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload sendMessagePayload
+
+	if err := utils.ParseJSON(w, r, &payload); err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(&payload); err != nil {
+		var validationErrors validator.ValidationErrors
+		var errorMessages []string
+		message := ""
+		if errors.As(err, &validationErrors) {
+			for _, value := range validationErrors {
+				switch value.Tag() {
+				case "required":
+					message = fmt.Sprintf("%s is %s", value.Field(), value.Tag())
+					errorMessages = append(errorMessages, message)
+				default:
+					message = fmt.Sprintf("The %s is invalid", value.Field())
+					errorMessages = append(errorMessages, message)
+				}
+			}
+		}
+
+		_ = app.WriteError(w, r, http.StatusUnprocessableEntity, errors.New(errorMessages[0]))
+		return
+	}
+
+	conversation := getConversationFromCtx(r)
+
+	message := &store.Message{
+		ConversationID: conversation.ID,
+		SenderID:       getUserFromContext(r).ID,
+		Content:        payload.Content,
+	}
+
+	ctx := r.Context()
+	if err := app.store.Conversations.SendMessage(ctx, message); err != nil {
+		switch {
+		case errors.Is(err, store.ErrBlocked), errors.Is(err, store.ErrMessagingNotAllowed):
+			_ = app.WriteError(w, r, http.StatusForbidden, err)
+			return
+		default:
+			_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	// the sender's other devices get it too
+	app.publishToParticipants(ctx, conversation, 0, "message", message)
+
+	_ = app.WriteJSON(w, r, http.StatusCreated, types.APIResponseBody{
+		Status:  true,
+		Message: "Message sent successfully",
+		Data:    message,
+	})
+	return
+}
+
+// markConversationReadHandler moves the read receipt of the user up to the
+// given message, or to the latest one when the request has no body.
+func (app *application) markConversationReadHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload markConversationReadPayload
+
+	if r.ContentLength != 0 {
+		if err := utils.ParseJSON(w, r, &payload); err != nil {
+			_ = app.WriteError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := utils.Validate.Struct(&payload); err != nil {
+			_ = app.WriteError(w, r, http.StatusUnprocessableEntity, err)
+			return
+		}
+	}
+
+	conversation := getConversationFromCtx(r)
+	user := getUserFromContext(r)
+
+	ctx := r.Context()
+	lastRead, err := app.store.Conversations.MarkRead(ctx, conversation.ID, user.ID, payload.MessageID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			_ = app.WriteError(w, r, http.StatusNotFound, err)
+			return
+		default:
+			_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	receipt := readReceipt{
+		ConversationID:    conversation.ID,
+		UserID:            user.ID,
+		LastReadMessageID: lastRead,
+	}
+
+	app.publishToParticipants(ctx, conversation, user.ID, "read", receipt)
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "Conversation marked as read",
+		Data:    receipt,
+	})
+	return
+}
+
+// publishToParticipants pushes an event to the sockets of every participant
+// of the conversation but skip, best effort like publishPost.
+func (app *application) publishToParticipants(ctx context.Context, conversation *store.Conversation, skip int64, event string, payload any) {
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		app.logger.Errorw("error encoding conversation event", "conversation", conversation.ID, "error", err.Error())
+		return
+	}
+
+	msg := pubsub.Message{
+		Event: event,
+		Data:  data,
+	}
+
+	for _, participant := range conversation.Participants {
+		if participant.ID == skip {
+			continue
+		}
+
+		if err := app.broker.Publish(ctx, userTopic(participant.ID), msg); err != nil {
+			app.logger.Errorw("error publishing conversation event", "conversation", conversation.ID, "user", participant.ID, "error", err.Error())
+		}
+	}
+}
+
+func (app *application) conversationContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		conversationIDAsStr := chi.URLParam(r, "conversationID")
+		conversationID, err := strconv.ParseInt(conversationIDAsStr, 10, 64)
+		if err != nil {
+			_ = app.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("invalid conversation id - %s", conversationIDAsStr))
+			return
+		}
+
+		// conversations of other users are not found rather than forbidden,
+		// so their ids do not leak
+		ctx := r.Context()
+		conversation, err := app.store.Conversations.GetByID(ctx, conversationID, getUserFromContext(r).ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				_ = app.WriteError(w, r, http.StatusNotFound, err)
+				return
+			default:
+				_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		ctx = context.WithValue(ctx, conversationCtx, conversation)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getConversationFromCtx(r *http.Request) *store.Conversation {
+	conversation, _ := r.Context().Value(conversationCtx).(*store.Conversation)
+	return conversation
+}
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"errors"
+	"github.com/nnxmxni/gophersocial/internals/ranking"
 	"github.com/nnxmxni/gophersocial/internals/store"
 	"github.com/nnxmxni/gophersocial/types"
 	"github.com/nnxmxni/gophersocial/utils"
 	"net/http"
+	"slices"
+	"time"
 )
 
 func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
@@ -13,6 +19,7 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 		Limit:  20,
 		Offset: 0,
 		Sort:   "desc",
+		Mode:   store.FeedModeChronological,
 	}
 
 	fq, err := fq.Parse(r)
@@ -26,16 +33,139 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	feeds, err := app.store.Posts.GetUserFeed(r.Context(), int64(2), fq)
+	if fq.Mode == store.FeedModeRanked {
+		app.getRankedFeed(w, r, fq)
+		return
+	}
+
+	feeds, err := app.getFeed(r.Context(), getUserFromContext(r).ID, fq)
 	if err != nil {
 		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
+	// a full page means there may be more posts after the last one
+	nextCursor := ""
+	if len(feeds) == fq.Limit {
+		last := feeds[len(feeds)-1]
+		nextCursor = store.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
 	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
 		Status:  true,
 		Message: "User feed retrieved successfully",
-		Data:    feeds,
+		Data: map[string]interface{}{
+			"feed":        feeds,
+			"next_cursor": nextCursor,
+		},
 	})
 	return
 }
+
+// getRankedFeed answers the feed request in ranked mode. The recent posts of
+// the followed accounts, and of the accounts they follow, are scored and the
+// page is cut from the best ones. Scores move as posts age, so the ranked
+// feed is paged with offset: a client may see a post twice across pages but
+// none is ever skipped for being past a cursor.
+func (app *application) getRankedFeed(w http.ResponseWriter, r *http.Request, fq store.PaginatedFeedQuery) {
+
+	if fq.Filtered() {
+		_ = app.WriteError(w, r, http.StatusBadRequest, errors.New("the ranked feed cannot be filtered"))
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+
+	ids, err := app.rankFeed(ctx, user.ID, fq.Offset, fq.Limit)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	posts, err := app.store.Posts.GetFeedByIDs(ctx, user.ID, ids)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	// the posts come back newest first, they are put back in ranked order
+	order := make(map[int64]int, len(ids))
+	for i, id := range ids {
+		order[id] = i
+	}
+
+	slices.SortFunc(posts, func(a, b store.PostWithMetaData) int {
+		return cmp.Compare(order[a.ID], order[b.ID])
+	})
+
+	var nextOffset *int
+	if len(ids) == fq.Limit {
+		next := fq.Offset + fq.Limit
+		nextOffset = &next
+	}
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "User feed retrieved successfully",
+		Data: map[string]interface{}{
+			"feed":        posts,
+			"next_offset": nextOffset,
+		},
+	})
+	return
+}
+
+// rankFeed returns the ids of the posts ranked from offset to offset+limit
+// in the feed of userID.
+func (app *application) rankFeed(ctx context.Context, userID int64, offset, limit int) ([]int64, error) {
+
+	candidates, err := app.store.Posts.GetFeedCandidates(ctx, userID, app.config.feedRanking.window, app.config.feedRanking.candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	weights := app.config.feedRanking.weights
+
+	scores := make(map[int64]float64, len(candidates))
+	for _, c := range candidates {
+		scores[c.ID] = weights.Score(ranking.Signals{
+			Age:          now.Sub(c.CreatedAt),
+			Comments:     c.Comments,
+			Interactions: c.Interactions,
+			SecondDegree: c.SecondDegree,
+		})
+	}
+
+	// a post scoring nothing was weighted out, e.g. second degree posts with
+	// a zero second degree weight
+	candidates = slices.DeleteFunc(candidates, func(c store.FeedCandidate) bool {
+		return scores[c.ID] == 0
+	})
+
+	slices.SortFunc(candidates, func(a, b store.FeedCandidate) int {
+		if c := cmp.Compare(scores[b.ID], scores[a.ID]); c != 0 {
+			return c
+		}
+
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+
+		return cmp.Compare(b.ID, a.ID)
+	})
+
+	if offset >= len(candidates) {
+		return []int64{}, nil
+	}
+
+	page := candidates[offset:min(offset+limit, len(candidates))]
+
+	ids := make([]int64, 0, len(page))
+	for _, c := range page {
+		ids = append(ids, c.ID)
+	}
+
+	return ids, nil
+}
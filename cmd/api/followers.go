@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/nnxmxni/gophersocial/internals/store"
+	"github.com/nnxmxni/gophersocial/types"
+	"github.com/nnxmxni/gophersocial/utils"
+	"net/http"
+	"strconv"
+)
+
+type followListFunc func(context.Context, int64, store.PaginatedFollowQuery) ([]store.FollowListEntry, error)
+
+func (app *application) getFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	app.writeFollowList(w, r, app.store.Followers.GetFollowers, "Followers retrieved successfully")
+}
+
+func (app *application) getFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	app.writeFollowList(w, r, app.store.Followers.GetFollowing, "Following retrieved successfully")
+}
+
+func (app *application) writeFollowList(w http.ResponseWriter, r *http.Request, list followListFunc, message string) {
+
+	fq := store.PaginatedFollowQuery{
+		Limit: 20,
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err = utils.Validate.Struct(fq); err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	users, err := list(r.Context(), getProfileFromContext(r).ID, fq)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	nextCursor := ""
+	if len(users) == fq.Limit {
+		last := users[len(users)-1]
+		nextCursor = store.Cursor{CreatedAt: last.FollowedAt, ID: last.ID}.Encode()
+	}
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: message,
+		Data: map[string]interface{}{
+			"users":       users,
+			"next_cursor": nextCursor,
+		},
+	})
+	return
+}
+
+func (app *application) getFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+
+	fq := store.PaginatedFollowQuery{
+		Limit: 20,
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err = utils.Validate.Struct(fq); err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	requests, err := app.store.Followers.GetFollowRequests(r.Context(), getUserFromContext(r).ID, fq)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	nextCursor := ""
+	if len(requests) == fq.Limit {
+		last := requests[len(requests)-1]
+		nextCursor = store.Cursor{CreatedAt: last.RequestedAt, ID: last.ID}.Encode()
+	}
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "Follow requests retrieved successfully",
+		Data: map[string]interface{}{
+			"requests":    requests,
+			"next_cursor": nextCursor,
+		},
+	})
+	return
+}
+
+func (app *application) approveFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	app.answerFollowRequest(w, r, app.store.Followers.ApproveFollowRequest, "Follow request approved")
+}
+
+func (app *application) rejectFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	app.answerFollowRequest(w, r, app.store.Followers.RejectFollowRequest, "Follow request rejected")
+}
+
+func (app *application) answerFollowRequest(w http.ResponseWriter, r *http.Request, answer func(context.Context, int64, int64) error, message string) {
+
+	requesterID, err := strconv.ParseInt(chi.URLParam(r, "requesterID"), 10, 64)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := answer(r.Context(), getUserFromContext(r).ID, requesterID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			_ = app.WriteError(w, r, http.StatusNotFound, err)
+			return
+		default:
+			_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	// an approved requester now has the posts of the user in their feed
+	app.invalidateTimelines(r.Context(), requesterID)
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: message,
+	})
+	return
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// runJanitor periodically purges expired one time passwords and, when a
+// grace period is configured, accounts that were never activated. It stops
+// when ctx is cancelled.
+func (app *application) runJanitor(ctx context.Context) {
+
+	ticker := time.NewTicker(app.config.janitor.interval)
+	defer ticker.Stop()
+
+	for {
+		app.cleanup(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) cleanup(ctx context.Context) {
+
+	purged, err := app.store.Users.DeleteExpiredInvitations(ctx)
+	if err != nil {
+		app.logger.Errorw("janitor: error purging expired one time passwords", "error", err.Error())
+	} else if purged > 0 {
+		app.logger.Infow("janitor: purged expired one time passwords", "count", purged)
+	}
+
+	if app.config.janitor.unverifiedGracePeriod <= 0 {
+		return
+	}
+
+	deleted, err := app.store.Users.DeleteUnverified(ctx, app.config.janitor.unverifiedGracePeriod)
+	if err != nil {
+		app.logger.Errorw("janitor: error deleting unverified users", "error", err.Error())
+	} else if deleted > 0 {
+		app.logger.Infow("janitor: deleted unverified users", "count", deleted)
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/nnxmxni/gophersocial/internals/store"
-	"net"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
@@ -37,20 +37,40 @@ func (app *application) EnsureAuthMiddleware(next http.Handler) http.Handler {
 
 		userID, _ := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
 
+		expiresAt, err := claims.GetExpirationTime()
+		if err != nil || expiresAt == nil {
+			_ = app.WriteError(w, r, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+
+		sessionID, _ := claims["sid"].(string)
+		if sessionID == "" {
+			_ = app.WriteError(w, r, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+
 		ctx := r.Context()
 
-		user, err := app.getUser(ctx, userID)
+		revoked, err := app.store.RefreshTokens.IsFamilyRevoked(ctx, sessionID)
 		if err != nil {
+			_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		if revoked {
 			_ = app.WriteError(w, r, http.StatusUnauthorized, errors.New("unauthorized"))
 			return
 		}
 
+		user, err := app.getUser(ctx, userID)
 		if err != nil {
 			_ = app.WriteError(w, r, http.StatusUnauthorized, errors.New("unauthorized"))
 			return
 		}
 
 		ctx = context.WithValue(ctx, userCtxKey, user)
+		ctx = context.WithValue(ctx, sessionCtxKey, sessionID)
+		ctx = context.WithValue(ctx, tokenExpiryCtxKey, expiresAt.Time)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -58,16 +78,49 @@ func (app *application) EnsureAuthMiddleware(next http.Handler) http.Handler {
 
 func (app *application) EnsurePostOwnership(role string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-
-		user := getUserFromContext(r)
 		post := getPostFromCtx(r)
+		app.ensureOwnership(w, r, post.UserID, role, next)
+	}
+}
 
-		if user.ID != post.UserID {
-			_ = app.WriteError(w, r, http.StatusForbidden, errors.New("forbidden"))
-			return
-		}
+func (app *application) EnsureCommentOwnership(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		comment := getCommentFromCtx(r)
+		app.ensureOwnership(w, r, comment.UserID, role, next)
+	}
+}
+
+// ensureOwnership lets the owner of a resource through, otherwise the
+// authenticated user needs a role at least as high as the one given.
+func (app *application) ensureOwnership(w http.ResponseWriter, r *http.Request, ownerID int64, role string, next http.HandlerFunc) {
+
+	user := getUserFromContext(r)
+
+	if user.ID == ownerID {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	allowed, err := app.confirmRolePrecedence(r.Context(), user, role)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if !allowed {
+		_ = app.WriteError(w, r, http.StatusForbidden, errors.New("forbidden"))
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
 
-		allowed, err := app.confirmRolePrecedence(r.Context(), user, role)
+// EnsureRole only lets through the users with a role at least as high as
+// the one given, owning the resource is not enough.
+func (app *application) EnsureRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		allowed, err := app.confirmRolePrecedence(r.Context(), getUserFromContext(r), role)
 		if err != nil {
 			_ = app.WriteError(w, r, http.StatusInternalServerError, err)
 			return
@@ -99,7 +152,6 @@ func (app *application) getUser(ctx context.Context, userID int64) (*store.User,
 
 	user, err := app.cacheStorage.Users.Get(ctx, userID)
 	if err != nil {
-		panic(err)
 		return nil, err
 	}
 
@@ -117,30 +169,132 @@ func (app *application) getUser(ctx context.Context, userID int64) (*store.User,
 	return user, nil
 }
 
-func (app *application) RateLimiterMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if app.config.rateLimiter.Enabled {
+// Rate limit policies, see the ratelimiter config in main. The client
+// policy goes ahead of authentication, so requests it turns away never cost
+// a session or user lookup.
+const (
+	policyStrict = "strict"
+	policyWrite  = "write"
+	policyRead   = "read"
+	policyClient = "client"
+)
+
+// RateLimiterMiddleware applies the named policy. Mounted after
+// EnsureAuthMiddleware the budget belongs to the user, so it follows them
+// across addresses, otherwise it belongs to the client IP.
+func (app *application) RateLimiterMiddleware(policy string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !app.config.rateLimiter.Enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
 
-			ip := r.RemoteAddr
-			// Strip the port if present
-			if host, _, err := net.SplitHostPort(ip); err == nil {
-				ip = host
+			limiter, ok := app.rateLimiters[policy]
+			if !ok {
+				_ = app.WriteError(w, r, http.StatusInternalServerError, fmt.Errorf("unknown rate limit policy: %s", policy))
+				return
 			}
 
-			// Check X-Forwarded-For header
-			if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-				// Use the first IP in the list
-				ips := strings.Split(xff, ",")
-				ip = strings.TrimSpace(ips[0])
+			key := policy + ":ip:" + getClientIPFromContext(r)
+			if user := getUserFromContext(r); user != nil {
+				key = policy + ":user:" + strconv.FormatInt(user.ID, 10)
 			}
 
-			if allow, retryAfter := app.rateLimiter.Allow(ip); !allow {
-				w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+			result := limiter.Allow(key)
+
+			reset := strconv.Itoa(int(math.Ceil(result.Reset.Seconds())))
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", reset)
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", reset)
 				_ = app.WriteError(w, r, http.StatusTooManyRequests, errors.New("too many requests"))
 				return
 			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimitByMethod uses the read policy for safe methods and the write
+// policy for everything else.
+func (app *application) RateLimitByMethod(next http.Handler) http.Handler {
+	read := app.RateLimiterMiddleware(policyRead)(next)
+	write := app.RateLimiterMiddleware(policyWrite)(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			read.ServeHTTP(w, r)
+		default:
+			write.ServeHTTP(w, r)
+		}
+	})
+}
+
+func isWebSocketRequest(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// WebSocketTokenMiddleware lets WebSocket handshakes carry the access token
+// in the access_token query parameter, since browsers cannot set headers on
+// them. It has to run before EnsureAuthMiddleware, and RedactTokenMiddleware
+// keeps the token out of the access logs.
+func (app *application) WebSocketTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("access_token")
+
+		if isWebSocketRequest(r) && token != "" && r.Header.Get("Authorization") == "" {
+			r = r.Clone(r.Context())
+			r.Header.Set("Authorization", "Bearer "+token)
 		}
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RedactTokenMiddleware masks the access_token query parameter in the
+// RequestURI the request logger prints. It has to run before the logger, the
+// parsed URL keeps the token for WebSocketTokenMiddleware.
+func (app *application) RedactTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		if query.Has("access_token") {
+			query.Set("access_token", "redacted")
+
+			uri := *r.URL
+			uri.RawQuery = query.Encode()
+			r.RequestURI = uri.RequestURI()
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ClientIPMiddleware resolves the client address once per request. It is
+// kept in the request context and also set as RemoteAddr so the request
+// logger reports the real client rather than the last proxy.
+func (app *application) ClientIPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := app.ipResolver.ClientIP(r)
+
+		r.RemoteAddr = ip
+
+		ctx := context.WithValue(r.Context(), clientIPCtxKey, ip)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+type clientIPKey string
+
+const clientIPCtxKey clientIPKey = "clientIP"
+
+func getClientIPFromContext(r *http.Request) string {
+	ip, _ := r.Context().Value(clientIPCtxKey).(string)
+	return ip
+}
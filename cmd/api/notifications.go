@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"github.com/nnxmxni/gophersocial/internals/store"
+	"github.com/nnxmxni/gophersocial/types"
+	"github.com/nnxmxni/gophersocial/utils"
+	"net/http"
+)
+
+type markNotificationsReadPayload struct {
+	IDs []int64 `json:"ids" validate:"max=100"`
+}
+
+func (app *application) getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+
+	nq := store.PaginatedNotificationQuery{
+		Limit: 20,
+	}
+
+	nq, err := nq.Parse(r)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err = utils.Validate.Struct(nq); err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	groups, err := app.store.Notifications.GetGroups(ctx, user.ID, nq)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	unread, err := app.store.Notifications.CountUnread(ctx, user.ID)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	nextCursor := ""
+	if len(groups) == nq.Limit {
+		last := groups[len(groups)-1]
+		nextCursor = store.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "Notifications retrieved successfully",
+		Data: map[string]interface{}{
+			"notifications": groups,
+			"unread_count":  unread,
+			"next_cursor":   nextCursor,
+		},
+	})
+	return
+}
+
+// markNotificationsReadHandler marks the groups given by their ids as read,
+// or every notification when the request has no body.
+func (app *application) markNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload markNotificationsReadPayload
+
+	if r.ContentLength != 0 {
+		if err := utils.ParseJSON(w, r, &payload); err != nil {
+			_ = app.WriteError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := utils.Validate.Struct(&payload); err != nil {
+			_ = app.WriteError(w, r, http.StatusUnprocessableEntity, err)
+			return
+		}
+	}
+
+	marked, err := app.store.Notifications.MarkRead(r.Context(), getUserFromContext(r).ID, payload.IDs)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "Notifications marked as read",
+		Data: map[string]interface{}{
+			"marked": marked,
+		},
+	})
+	return
+}
+
+// notify records n on behalf of the request that caused it. Like
+// publishPost it is best effort, the action itself already succeeded.
+func (app *application) notify(ctx context.Context, n *store.Notification) {
+	if err := app.store.Notifications.Create(ctx, n); err != nil {
+		app.logger.Errorw("error creating notification", "kind", n.Kind, "user", n.UserID, "error", err.Error())
+	}
+}
+
+func (app *application) notifyMentions(ctx context.Context, n *store.Notification, text string) {
+	if err := app.store.Notifications.CreateMentions(ctx, n, text); err != nil {
+		app.logger.Errorw("error creating mention notifications", "actor", n.ActorID, "error", err.Error())
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/nnxmxni/gophersocial/internals/mailer"
+	"github.com/nnxmxni/gophersocial/internals/store"
+	"github.com/nnxmxni/gophersocial/types"
+	"github.com/nnxmxni/gophersocial/utils"
+	"net/http"
+)
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+}
+
+func (app *application) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload ForgotPasswordPayload
+	if err := utils.ParseJSON(w, r, &payload); err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(&payload); err != nil {
+		_ = app.WriteError(w, r, http.StatusUnprocessableEntity, errors.New("The Email is invalid"))
+		return
+	}
+
+	// the response is the same whether the email is known or not, so the
+	// endpoint cannot be used to find out who has an account
+	response := types.APIResponseBody{
+		Status:  true,
+		Message: "If the email belongs to an account, a password reset link has been sent to it",
+	}
+
+	ctx := r.Context()
+
+	user, err := app.store.Users.GetByEmail(ctx, payload.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			_ = app.WriteJSON(w, r, http.StatusOK, response)
+			return
+		default:
+			_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	plainToken := uuid.New().String()
+
+	if err := app.store.Users.CreatePasswordReset(ctx, user, hashToken(plainToken), app.config.mail.PasswordResetExpiration); err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	// sent in the background, waiting on the mail server would make known
+	// emails answer slower than unknown ones
+	go app.sendPasswordResetEmail(context.WithoutCancel(ctx), user, plainToken)
+
+	_ = app.WriteJSON(w, r, http.StatusOK, response)
+	return
+}
+
+func (app *application) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload ResetPasswordPayload
+	if err := utils.ParseJSON(w, r, &payload); err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(&payload); err != nil {
+
+		var validationErrors validator.ValidationErrors
+		var errorMessages []string
+		message := ""
+		if errors.As(err, &validationErrors) {
+			for _, value := range validationErrors {
+				switch value.Tag() {
+				case "required":
+					message = fmt.Sprintf("%s is %s", value.Field(), value.Tag())
+					errorMessages = append(errorMessages, message)
+				default:
+					message = fmt.Sprintf("The %s is invalid", value.Field())
+					errorMessages = append(errorMessages, message)
+				}
+			}
+		}
+
+		_ = app.WriteError(w, r, http.StatusUnprocessableEntity, errors.New(errorMessages[0]))
+		return
+	}
+
+	if err := app.store.Users.ResetPassword(r.Context(), payload.Token, payload.Password); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			_ = app.WriteError(w, r, http.StatusBadRequest, errors.New("the reset token is invalid or has expired"))
+			return
+		default:
+			_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "Your password has been reset, please log in again",
+	})
+	return
+}
+
+// sendPasswordResetEmail mails the reset link to user. The request was
+// answered by the time it runs, so a failure is only logged.
+func (app *application) sendPasswordResetEmail(ctx context.Context, user *store.User, plainToken string) {
+
+	data := struct {
+		Email     string
+		ResetURL  string
+		ExpiresIn string
+	}{
+		Email:     user.Email,
+		ResetURL:  fmt.Sprintf("%s/reset-password/%s", app.config.frontendURL, plainToken),
+		ExpiresIn: fmt.Sprintf("%d minutes", int(app.config.mail.PasswordResetExpiration.Minutes())),
+	}
+
+	if err := app.mailer.Send(ctx, mailer.PasswordResetTemplate, user.Email, data); err != nil {
+		app.logger.Errorw("error sending password reset email", "email", user.Email, "error", err.Error())
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/nnxmxni/gophersocial/utils"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 type postKey string
@@ -18,14 +19,18 @@ type postKey string
 const postCtx postKey = "post"
 
 type createPostPayload struct {
-	Title   string   `json:"title" validate:"required"`
-	Content string   `json:"content" validate:"required"`
-	Tags    []string `json:"tags"`
+	Title     string     `json:"title" validate:"required"`
+	Content   string     `json:"content" validate:"required"`
+	Tags      []string   `json:"tags" validate:"max=10"`
+	Status    string     `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt *time.Time `json:"publish_at"`
 }
 
 type updatePostPayload struct {
-	Title   *string `json:"title" validate:"omitempty,max=100"`
-	Content *string `json:"content" validate:"omitempty,max=1000"`
+	Title     *string    `json:"title" validate:"omitempty,max=100"`
+	Content   *string    `json:"content" validate:"omitempty,max=1000"`
+	Status    *string    `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt *time.Time `json:"publish_at"`
 }
 
 func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request) {
@@ -57,11 +62,29 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// hashtags written in the content tag the post as well
+	tags, err := store.NormalizeTags(append(payload.Tags, store.ExtractHashtags(payload.Content)...))
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	status, publishAt, err := store.ResolvePostStatus(payload.Status, payload.PublishAt, time.Now())
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+
 	post := &store.Post{
-		Title:   payload.Title,
-		Content: payload.Content,
-		Tags:    payload.Tags,
-		UserID:  getUserFromContext(r).ID,
+		Title:     payload.Title,
+		Content:   payload.Content,
+		Tags:      tags,
+		Status:    status,
+		PublishAt: publishAt,
+		UserID:    user.ID,
+		User:      store.User{ID: user.ID, Username: user.Username},
 	}
 
 	ctx := r.Context()
@@ -70,9 +93,19 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	message := "Post created successfully"
+	switch post.Status {
+	case store.PostStatusPublished:
+		app.announcePost(ctx, post)
+	case store.PostStatusScheduled:
+		message = "Post scheduled successfully"
+	case store.PostStatusDraft:
+		message = "Draft saved successfully"
+	}
+
 	if err := app.WriteJSON(w, r, http.StatusCreated, types.APIResponseBody{
 		Status:  true,
-		Message: "Post created successfully",
+		Message: message,
 		Data:    post,
 	}); err != nil {
 		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
@@ -84,7 +117,7 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 
 	post := getPostFromCtx(r)
 
-	comments, err := app.store.Comment.GetByPostID(r.Context(), post.ID)
+	comments, err := app.store.Comment.GetByPostID(r.Context(), post.ID, getUserFromContext(r).ID)
 	if err != nil {
 		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
 		return
@@ -92,6 +125,14 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 
 	post.Comments = comments
 
+	reactions, err := app.store.Reactions.GetSummary(r.Context(), post.ID, getUserFromContext(r).ID)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	post.Reactions = *reactions
+
 	if err := app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
 		Status:  true,
 		Message: "Post retrieved successfully",
@@ -126,9 +167,47 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		post.Title = *payload.Title
 	}
 
-	if err := app.store.Posts.Update(r.Context(), post); err != nil {
-		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
-		return
+	// the status is left for the store to keep, the one read with the post
+	// may be stale by the time it is saved
+	post.Status, post.PublishAt = "", nil
+
+	if payload.Status != nil || payload.PublishAt != nil {
+		status := ""
+		if payload.Status != nil {
+			status = *payload.Status
+		}
+
+		status, publishAt, err := store.ResolvePostStatus(status, payload.PublishAt, time.Now())
+		if err != nil {
+			_ = app.WriteError(w, r, http.StatusUnprocessableEntity, err)
+			return
+		}
+
+		post.Status, post.PublishAt = status, publishAt
+	}
+
+	ctx := r.Context()
+	published, err := app.store.Posts.Update(ctx, post, getUserFromContext(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			_ = app.WriteError(w, r, http.StatusNotFound, err)
+			return
+		case errors.Is(err, store.ErrAlreadyPublished):
+			_ = app.WriteError(w, r, http.StatusConflict, err)
+			return
+		default:
+			_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	// only the author sees an unpublished post, so they are the one
+	// publishing it
+	if published {
+		user := getUserFromContext(r)
+		post.User = store.User{ID: user.ID, Username: user.Username}
+		app.announcePost(ctx, post)
 	}
 
 	if err := app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
@@ -145,7 +224,8 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 
 	post := getPostFromCtx(r)
 
-	if err := app.store.Posts.Delete(r.Context(), post.ID); err != nil {
+	ctx := r.Context()
+	if err := app.store.Posts.Delete(ctx, post.ID); err != nil {
 		switch {
 		case errors.Is(err, store.ErrNotFound):
 			_ = app.WriteError(w, r, http.StatusNotFound, err)
@@ -156,6 +236,8 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 		}
 	}
 
+	app.removeFromTimelines(ctx, post)
+
 	if err := app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
 		Status:  true,
 		Message: "Post deleted successfully",
@@ -165,6 +247,46 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
+func (app *application) getDraftsHandler(w http.ResponseWriter, r *http.Request) {
+
+	dq := store.PaginatedDraftQuery{
+		Limit: 20,
+	}
+
+	dq, err := dq.Parse(r)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err = utils.Validate.Struct(dq); err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	drafts, err := app.store.Posts.GetDrafts(r.Context(), getUserFromContext(r).ID, dq)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	nextCursor := ""
+	if len(drafts) == dq.Limit {
+		last := drafts[len(drafts)-1]
+		nextCursor = store.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "Drafts retrieved successfully",
+		Data: map[string]interface{}{
+			"drafts":      drafts,
+			"next_cursor": nextCursor,
+		},
+	})
+	return
+}
+
 func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -188,6 +310,33 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 			}
 		}
 
+		// drafts and scheduled posts are only there for their author
+		if post.Status != store.PostStatusPublished && post.UserID != getUserFromContext(r).ID {
+			_ = app.WriteError(w, r, http.StatusNotFound, store.ErrNotFound)
+			return
+		}
+
+		// posts of private accounts are only there for their followers, and
+		// for moderators who may have to act on them
+		visible, err := app.store.Followers.CanSeePosts(ctx, getUserFromContext(r).ID, post.UserID)
+		if err != nil {
+			_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		if !visible {
+			visible, err = app.confirmRolePrecedence(ctx, getUserFromContext(r), "moderator")
+			if err != nil {
+				_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		if !visible {
+			_ = app.WriteError(w, r, http.StatusNotFound, store.ErrNotFound)
+			return
+		}
+
 		ctx = context.WithValue(r.Context(), postCtx, post)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/nnxmxni/gophersocial/internals/store"
+	"github.com/nnxmxni/gophersocial/types"
+	"net/http"
+)
+
+func (app *application) addReactionHandler(w http.ResponseWriter, r *http.Request) {
+
+	post := getPostFromCtx(r)
+	user := getUserFromContext(r)
+
+	ctx := r.Context()
+	if err := app.store.Reactions.Add(ctx, post.ID, user.ID, chi.URLParam(r, "kind")); err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidReaction):
+			_ = app.WriteError(w, r, http.StatusBadRequest, err)
+			return
+		default:
+			_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	app.notify(ctx, &store.Notification{
+		UserID:  post.UserID,
+		ActorID: user.ID,
+		Kind:    store.NotificationReaction,
+		PostID:  &post.ID,
+	})
+
+	app.writeReactionSummary(w, r, "Reaction added successfully")
+}
+
+func (app *application) removeReactionHandler(w http.ResponseWriter, r *http.Request) {
+
+	post := getPostFromCtx(r)
+	user := getUserFromContext(r)
+
+	ctx := r.Context()
+	if err := app.store.Reactions.Remove(ctx, post.ID, user.ID, chi.URLParam(r, "kind")); err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidReaction):
+			_ = app.WriteError(w, r, http.StatusBadRequest, err)
+			return
+		default:
+			_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	app.writeReactionSummary(w, r, "Reaction removed successfully")
+}
+
+// writeReactionSummary answers with the updated reactions of the post so
+// clients do not have to fetch the post again to refresh the counts.
+func (app *application) writeReactionSummary(w http.ResponseWriter, r *http.Request, message string) {
+
+	summary, err := app.store.Reactions.GetSummary(r.Context(), getPostFromCtx(r).ID, getUserFromContext(r).ID)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: message,
+		Data: map[string]interface{}{
+			"reactions": summary,
+		},
+	})
+}
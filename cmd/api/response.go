@@ -10,7 +10,7 @@ func (app *application) WriteJSON(w http.ResponseWriter, r *http.Request, status
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 
-	app.logger.Infow(response.Message, "path", r.URL.Path, "method", r.Method)
+	app.logger.Infow(response.Message, "path", r.URL.Path, "method", r.Method, "ip", getClientIPFromContext(r))
 
 	return json.NewEncoder(w).Encode(response)
 }
@@ -25,7 +25,7 @@ func (app *application) WriteError(w http.ResponseWriter, r *http.Request, statu
 		Message: err.Error(),
 	}
 
-	app.logger.Errorw(err.Error(), "path", r.URL.Path, "method", r.Method)
+	app.logger.Errorw(err.Error(), "path", r.URL.Path, "method", r.Method, "ip", getClientIPFromContext(r))
 
 	return json.NewEncoder(w).Encode(response)
 }
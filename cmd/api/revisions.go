@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/nnxmxni/gophersocial/internals/store"
+	"github.com/nnxmxni/gophersocial/types"
+	"github.com/nnxmxni/gophersocial/utils"
+	"net/http"
+	"strconv"
+)
+
+// getPostRevisionsHandler lists the earlier versions of a published post,
+// to its author and moderators only.
+func (app *application) getPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	rq := store.PaginatedRevisionQuery{
+		Limit: 20,
+	}
+
+	rq, err := rq.Parse(r)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err = utils.Validate.Struct(rq); err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	revisions, err := app.store.Posts.GetRevisions(r.Context(), getPostFromCtx(r).ID, rq)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	nextCursor := ""
+	if len(revisions) == rq.Limit {
+		last := revisions[len(revisions)-1]
+		nextCursor = store.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "Post revisions retrieved successfully",
+		Data: map[string]interface{}{
+			"revisions":   revisions,
+			"next_cursor": nextCursor,
+		},
+	})
+	return
+}
+
+// restorePostRevisionHandler puts a previous version of a post back, the
+// current one is kept as a revision.
+func (app *application) restorePostRevisionHandler(w http.ResponseWriter, r *http.Request) {
+
+	revisionID, err := strconv.ParseInt(chi.URLParam(r, "revisionID"), 10, 64)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	post := getPostFromCtx(r)
+
+	if err := app.store.Posts.RestoreRevision(r.Context(), post, revisionID, getUserFromContext(r).ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			_ = app.WriteError(w, r, http.StatusNotFound, err)
+			return
+		default:
+			_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "Post revision restored successfully",
+		Data:    post,
+	})
+	return
+}
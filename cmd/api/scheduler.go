@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"github.com/nnxmxni/gophersocial/internals/store"
+	"time"
+)
+
+// runScheduler periodically publishes the scheduled posts that are due. It
+// is safe to run on every replica, each due post is claimed by only one of
+// them. It stops when ctx is cancelled.
+func (app *application) runScheduler(ctx context.Context) {
+
+	ticker := time.NewTicker(app.config.scheduler.interval)
+	defer ticker.Stop()
+
+	for {
+		app.publishDuePosts(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) publishDuePosts(ctx context.Context) {
+
+	// batches are published until one comes back short, so a backlog is
+	// cleared in one tick rather than a batch per tick
+	for ctx.Err() == nil {
+		posts, err := app.store.Posts.PublishDue(ctx, app.config.scheduler.batchSize)
+		if err != nil {
+			app.logger.Errorw("scheduler: error publishing due posts", "error", err.Error())
+			return
+		}
+
+		for i := range posts {
+			app.announcePost(ctx, &posts[i])
+		}
+
+		if len(posts) > 0 {
+			app.logger.Infow("scheduler: published scheduled posts", "count", len(posts))
+		}
+
+		if len(posts) < app.config.scheduler.batchSize {
+			return
+		}
+	}
+}
+
+// announcePost runs what follows the publication of a post, whether it is
+// published on creation, from a draft or by the scheduler. Each step is
+// best effort, the post is published either way.
+func (app *application) announcePost(ctx context.Context, post *store.Post) {
+
+	app.publishPost(ctx, post)
+	app.fanOutPost(ctx, post)
+	app.notifyMentions(ctx, &store.Notification{
+		ActorID: post.UserID,
+		PostID:  &post.ID,
+	}, post.Title+"\n"+post.Content)
+}
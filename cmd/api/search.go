@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"github.com/nnxmxni/gophersocial/internals/store"
+	"github.com/nnxmxni/gophersocial/types"
+	"github.com/nnxmxni/gophersocial/utils"
+	"net/http"
+)
+
+func (app *application) searchPostsHandler(w http.ResponseWriter, r *http.Request) {
+
+	sq, ok := app.parseSearchQuery(w, r)
+	if !ok {
+		return
+	}
+
+	posts, err := app.store.Posts.Search(r.Context(), getUserFromContext(r).ID, sq)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "Posts retrieved successfully",
+		Data: map[string]interface{}{
+			"posts": posts,
+		},
+	})
+	return
+}
+
+func (app *application) searchUsersHandler(w http.ResponseWriter, r *http.Request) {
+
+	sq, ok := app.parseSearchQuery(w, r)
+	if !ok {
+		return
+	}
+
+	users, err := app.store.Users.Search(r.Context(), getUserFromContext(r).ID, sq)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "Users retrieved successfully",
+		Data: map[string]interface{}{
+			"users": users,
+		},
+	})
+	return
+}
+
+// parseSearchQuery answers the request itself when the query is invalid,
+// ok tells the caller whether to go on.
+func (app *application) parseSearchQuery(w http.ResponseWriter, r *http.Request) (sq store.PaginatedSearchQuery, ok bool) {
+
+	sq = store.PaginatedSearchQuery{
+		Limit: 20,
+	}
+
+	sq, err := sq.Parse(r)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return sq, false
+	}
+
+	if sq.Query == "" {
+		_ = app.WriteError(w, r, http.StatusBadRequest, errors.New("the q parameter is required"))
+		return sq, false
+	}
+
+	if err = utils.Validate.Struct(sq); err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return sq, false
+	}
+
+	return sq, true
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/nnxmxni/gophersocial/internals/pubsub"
+	"github.com/nnxmxni/gophersocial/internals/store"
+	"net/http"
+	"time"
+)
+
+// feedTopic carries every new post, each stream keeps the ones that belong
+// to the feed of its user.
+const feedTopic = "feed.posts"
+
+// userTopic carries the events addressed to a single user, whatever
+// replica their connection is held by.
+func userTopic(userID int64) string {
+	return fmt.Sprintf("user.%d", userID)
+}
+
+// streamReplayLimit bounds how many missed posts are sent to a client
+// resuming with Last-Event-ID, older ones are left to the paginated feed.
+const streamReplayLimit = 20
+
+// publishPost announces a new post to the feed streams. It is best effort,
+// a failure is logged and does not fail the request that created the post.
+func (app *application) publishPost(ctx context.Context, post *store.Post) {
+
+	data, err := json.Marshal(post)
+	if err != nil {
+		app.logger.Errorw("error encoding post for the feed stream", "post", post.ID, "error", err.Error())
+		return
+	}
+
+	msg := pubsub.Message{
+		ID:    store.Cursor{CreatedAt: post.CreatedAt, ID: post.ID}.Encode(),
+		Event: "post",
+		Data:  data,
+	}
+
+	if err := app.broker.Publish(ctx, feedTopic, msg); err != nil {
+		app.logger.Errorw("error publishing post to the feed stream", "post", post.ID, "error", err.Error())
+	}
+}
+
+func (app *application) feedStreamHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	// EventSource sends the header when it reconnects, the query parameter
+	// is for clients that cannot set headers
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+
+	var resumeFrom *store.Cursor
+	if lastEventID != "" {
+		c, err := store.DecodeCursor(lastEventID)
+		if err != nil {
+			_ = app.WriteError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		resumeFrom = c
+	}
+
+	authors, err := app.feedAuthors(ctx, user.ID)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	// subscribing before the replay means a post created in between is
+	// buffered rather than lost, last then keeps it from being sent twice
+	sub := app.broker.Subscribe(feedTopic)
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// last is the position of the newest post replayed. Posts are compared
+	// by (created_at, id) rather than id alone, a draft or scheduled post
+	// keeps the lower id it was written with when it is published later.
+	var last store.Cursor
+
+	if resumeFrom != nil {
+		missed, err := app.store.Posts.GetUserFeed(ctx, user.ID, store.PaginatedFeedQuery{
+			Limit:  streamReplayLimit,
+			Sort:   "asc",
+			Cursor: resumeFrom,
+		})
+		if err != nil {
+			app.logger.Errorw("error replaying the feed stream", "user", user.ID, "error", err.Error())
+			return
+		}
+
+		for _, post := range missed {
+			data, err := json.Marshal(post.Post)
+			if err != nil {
+				return
+			}
+
+			msg := pubsub.Message{
+				ID:    store.Cursor{CreatedAt: post.CreatedAt, ID: post.ID}.Encode(),
+				Event: "post",
+				Data:  data,
+			}
+
+			if err := writeEvent(w, msg); err != nil {
+				return
+			}
+
+			last = store.Cursor{CreatedAt: post.CreatedAt, ID: post.ID}
+		}
+	}
+
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(app.config.stream.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+
+			if err := rc.Flush(); err != nil {
+				return
+			}
+
+			// follows and mutes may have changed since the stream opened
+			if refreshed, err := app.feedAuthors(ctx, user.ID); err == nil {
+				authors = refreshed
+			}
+
+		case msg, ok := <-sub.C:
+			if !ok {
+				return
+			}
+
+			var post store.Post
+			if err := json.Unmarshal(msg.Data, &post); err != nil {
+				continue
+			}
+
+			if !authors[post.UserID] || !(store.Cursor{CreatedAt: post.CreatedAt, ID: post.ID}).After(last) {
+				continue
+			}
+
+			if err := writeEvent(w, msg); err != nil {
+				return
+			}
+
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (app *application) feedAuthors(ctx context.Context, userID int64) (map[int64]bool, error) {
+
+	ids, err := app.store.Followers.GetFeedAuthorIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	authors := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		authors[id] = true
+	}
+
+	return authors, nil
+}
+
+func writeEvent(w http.ResponseWriter, msg pubsub.Message) error {
+	_, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", msg.ID, msg.Event, msg.Data)
+	return err
+}
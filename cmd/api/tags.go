@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/nnxmxni/gophersocial/internals/store"
+	"github.com/nnxmxni/gophersocial/types"
+	"github.com/nnxmxni/gophersocial/utils"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The window of the trending tags is bounded, a wider one would scan most
+// of the posts table.
+const (
+	trendingWindowDefault = 24 * time.Hour
+	trendingWindowMin     = time.Hour
+	trendingWindowMax     = 7 * 24 * time.Hour
+	trendingLimitMax      = 50
+)
+
+func (app *application) getTagPostsHandler(w http.ResponseWriter, r *http.Request) {
+
+	tags, err := store.NormalizeTags([]string{chi.URLParam(r, "tag")})
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	tq := store.PaginatedTagQuery{
+		Limit: 20,
+	}
+
+	tq, err = tq.Parse(r)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err = utils.Validate.Struct(tq); err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	posts, err := app.store.Tags.GetPosts(r.Context(), getUserFromContext(r).ID, tags[0], tq)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	nextCursor := ""
+	if len(posts) == tq.Limit {
+		last := posts[len(posts)-1]
+		nextCursor = store.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "Posts retrieved successfully",
+		Data: map[string]interface{}{
+			"tag":         tags[0],
+			"posts":       posts,
+			"next_cursor": nextCursor,
+		},
+	})
+	return
+}
+
+// getTrendingTagsHandler ranks the tags of the last 24 hours, or of the
+// window given as a duration such as "6h".
+func (app *application) getTrendingTagsHandler(w http.ResponseWriter, r *http.Request) {
+
+	qs := r.URL.Query()
+
+	window := trendingWindowDefault
+	if v := qs.Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < trendingWindowMin || d > trendingWindowMax {
+			_ = app.WriteError(w, r, http.StatusBadRequest, errors.New("the window must be a duration between 1h and 168h"))
+			return
+		}
+
+		window = d
+	}
+
+	limit := 10
+	if v := qs.Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 || l > trendingLimitMax {
+			_ = app.WriteError(w, r, http.StatusBadRequest, errors.New("the limit must be between 1 and 50"))
+			return
+		}
+
+		limit = l
+	}
+
+	tags, err := app.store.Tags.GetTrending(r.Context(), window, limit)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "Trending tags retrieved successfully",
+		Data: map[string]interface{}{
+			"window": window.String(),
+			"tags":   tags,
+		},
+	})
+	return
+}
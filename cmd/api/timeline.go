@@ -0,0 +1,159 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"github.com/nnxmxni/gophersocial/internals/store"
+	"slices"
+)
+
+// getFeed serves the plain feed pages from the timeline precomputed in
+// Redis, merged with the posts of the authors followed by too many users to
+// be pushed to timelines. Filtered pages, and every page while Redis is
+// disabled or the timeline cannot answer, are built by the feed query.
+func (app *application) getFeed(ctx context.Context, userID int64, fq store.PaginatedFeedQuery) ([]store.PostWithMetaData, error) {
+
+	if !app.config.redisCfg.enabled || !timelineServes(fq) {
+		return app.store.Posts.GetUserFeed(ctx, userID, fq)
+	}
+
+	pushed, ok, err := app.cacheStorage.Timelines.Get(ctx, userID, fq.Cursor, fq.Limit)
+	if err != nil {
+		app.logger.Errorw("error reading the timeline", "user", userID, "error", err.Error())
+		return app.store.Posts.GetUserFeed(ctx, userID, fq)
+	}
+
+	if !ok {
+		// the first page is read on every visit, later pages only miss once
+		// the client pages past what the timeline holds
+		if fq.Cursor == nil {
+			app.rebuildTimeline(ctx, userID)
+		}
+
+		return app.store.Posts.GetUserFeed(ctx, userID, fq)
+	}
+
+	pulled, err := app.store.Posts.GetFeedEntries(ctx, userID, store.FeedEntryQuery{
+		Limit:              fq.Limit,
+		Cursor:             fq.Cursor,
+		FanoutMaxFollowers: app.config.timeline.fanoutMaxFollowers,
+		Pulled:             true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return app.store.Posts.GetFeedByIDs(ctx, userID, mergeFeedEntries(pushed, pulled, fq.Limit))
+}
+
+// timelineServes tells whether a feed page can be read from the timeline,
+// which only holds the newest posts in order.
+func timelineServes(fq store.PaginatedFeedQuery) bool {
+	return fq.Sort == "desc" && fq.Offset == 0 && !fq.Filtered()
+}
+
+// mergeFeedEntries returns the ids of the newest limit entries of both
+// lists. An author who crossed the fan-out threshold can be in both.
+func mergeFeedEntries(pushed, pulled []store.FeedEntry, limit int) []int64 {
+
+	entries := append(pushed, pulled...)
+	slices.SortFunc(entries, func(a, b store.FeedEntry) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+
+		return cmp.Compare(b.ID, a.ID)
+	})
+
+	ids := make([]int64, 0, limit)
+	for i, e := range entries {
+		if len(ids) == limit {
+			break
+		}
+
+		if i > 0 && entries[i-1].ID == e.ID {
+			continue
+		}
+
+		ids = append(ids, e.ID)
+	}
+
+	return ids
+}
+
+// rebuildTimeline fills the timeline of userID from the database. It is
+// best effort, the feed is still served by the query when it fails.
+func (app *application) rebuildTimeline(ctx context.Context, userID int64) {
+
+	entries, err := app.store.Posts.GetFeedEntries(ctx, userID, store.FeedEntryQuery{
+		Limit:              app.config.timeline.size,
+		FanoutMaxFollowers: app.config.timeline.fanoutMaxFollowers,
+	})
+	if err != nil {
+		app.logger.Errorw("error loading the timeline", "user", userID, "error", err.Error())
+		return
+	}
+
+	if err := app.cacheStorage.Timelines.Set(ctx, userID, entries); err != nil {
+		app.logger.Errorw("error storing the timeline", "user", userID, "error", err.Error())
+	}
+}
+
+// fanOutPost pushes a new post to the timelines of its author and their
+// followers, unless the author has too many followers for it.
+func (app *application) fanOutPost(ctx context.Context, post *store.Post) {
+
+	if !app.config.redisCfg.enabled {
+		return
+	}
+
+	userIDs, fanout, err := app.store.Followers.GetFanoutTargets(ctx, post.UserID, app.config.timeline.fanoutMaxFollowers)
+	if err != nil {
+		app.logger.Errorw("error listing the timelines of a post", "post", post.ID, "error", err.Error())
+		return
+	}
+
+	if !fanout {
+		return
+	}
+
+	if err := app.cacheStorage.Timelines.Add(ctx, userIDs, store.FeedEntry{ID: post.ID, CreatedAt: post.CreatedAt}); err != nil {
+		app.logger.Errorw("error pushing post to timelines", "post", post.ID, "error", err.Error())
+	}
+}
+
+// removeFromTimelines takes a deleted post out of the timelines it was
+// pushed to.
+func (app *application) removeFromTimelines(ctx context.Context, post *store.Post) {
+
+	if !app.config.redisCfg.enabled {
+		return
+	}
+
+	userIDs, fanout, err := app.store.Followers.GetFanoutTargets(ctx, post.UserID, app.config.timeline.fanoutMaxFollowers)
+	if err != nil {
+		app.logger.Errorw("error listing the timelines of a post", "post", post.ID, "error", err.Error())
+		return
+	}
+
+	if !fanout {
+		return
+	}
+
+	if err := app.cacheStorage.Timelines.Remove(ctx, userIDs, post.ID); err != nil {
+		app.logger.Errorw("error removing post from timelines", "post", post.ID, "error", err.Error())
+	}
+}
+
+// invalidateTimelines drops the timelines of users whose follows or mutes
+// changed, they are rebuilt on their next read.
+func (app *application) invalidateTimelines(ctx context.Context, userIDs ...int64) {
+
+	if !app.config.redisCfg.enabled {
+		return
+	}
+
+	if err := app.cacheStorage.Timelines.Invalidate(ctx, userIDs...); err != nil {
+		app.logger.Errorw("error invalidating timelines", "users", userIDs, "error", err.Error())
+	}
+}
@@ -4,17 +4,90 @@ import (
 	"context"
 	"errors"
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"github.com/nnxmxni/gophersocial/internals/store"
 	"github.com/nnxmxni/gophersocial/types"
+	"github.com/nnxmxni/gophersocial/utils"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 type userKey string
 
-const userCtxKey userKey = "user"
+const (
+	userCtxKey    userKey = "user"
+	sessionCtxKey userKey = "session"
+	// tokenExpiryCtxKey holds when the access token of the request expires.
+	tokenExpiryCtxKey userKey = "tokenExpiry"
+	// profileCtxKey holds the user addressed by the {userID} path parameter,
+	// which is not necessarily the authenticated one.
+	profileCtxKey userKey = "profile"
+)
+
+type UpdateProfilePayload struct {
+	Username              *string `json:"username" validate:"omitempty,username"`
+	DisplayName           *string `json:"display_name" validate:"omitempty,max=100"`
+	Bio                   *string `json:"bio" validate:"omitempty,max=500"`
+	AvatarURL             *string `json:"avatar_url" validate:"omitempty,url,max=2048"`
+	IsPrivate             *bool   `json:"is_private"`
+	MessagesFollowersOnly *bool   `json:"messages_followers_only"`
+}
 
 func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
+	app.writeProfile(w, r, getProfileFromContext(r))
+}
+
+func (app *application) getUserByUsernameHandler(w http.ResponseWriter, r *http.Request) {
+
+	user, err := app.store.Users.GetByUsername(r.Context(), chi.URLParam(r, "username"))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			_ = app.WriteError(w, r, http.StatusNotFound, err)
+			return
+		default:
+			_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	app.writeProfile(w, r, user)
+}
+
+// writeProfile answers with the public projection of user, its counters and
+// how it relates to the authenticated viewer.
+func (app *application) writeProfile(w http.ResponseWriter, r *http.Request, user *store.User) {
+
+	ctx := r.Context()
+
+	stats, err := app.store.Users.GetStats(ctx, user.ID)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	relationship, err := app.store.Followers.GetRelationship(ctx, getUserFromContext(r).ID, user.ID)
+	if err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "User retrieved successfully",
+		Data: map[string]interface{}{
+			"user":         user.Public(),
+			"stats":        stats,
+			"relationship": relationship,
+		},
+	}); err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+}
+
+func (app *application) getMeHandler(w http.ResponseWriter, r *http.Request) {
 
 	if err := app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
 		Status:  true,
@@ -28,17 +101,82 @@ func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) updateMeHandler(w http.ResponseWriter, r *http.Request) {
 
 	user := getUserFromContext(r)
 
-	toBeFollowedUser, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
-	if err != nil {
+	var payload UpdateProfilePayload
+	if err := utils.ParseJSON(w, r, &payload); err != nil {
 		_ = app.WriteError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	if err := app.store.Followers.Follow(r.Context(), user.ID, toBeFollowedUser); err != nil {
+	if err := utils.Validate.Struct(&payload); err != nil {
+		_ = app.WriteError(w, r, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	if payload.Username != nil {
+		user.Username = *payload.Username
+	}
+
+	if payload.DisplayName != nil {
+		user.DisplayName = *payload.DisplayName
+	}
+
+	if payload.Bio != nil {
+		user.Bio = *payload.Bio
+	}
+
+	if payload.AvatarURL != nil {
+		user.AvatarURL = *payload.AvatarURL
+	}
+
+	if payload.IsPrivate != nil {
+		user.IsPrivate = *payload.IsPrivate
+	}
+
+	if payload.MessagesFollowersOnly != nil {
+		user.MessagesFollowersOnly = *payload.MessagesFollowersOnly
+	}
+
+	ctx := r.Context()
+	if err := app.store.Users.UpdateProfile(ctx, user); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicateUsername):
+			_ = app.WriteError(w, r, http.StatusConflict, err)
+			return
+		default:
+			_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if app.config.redisCfg.enabled {
+		if err := app.cacheStorage.Users.Delete(ctx, user.ID); err != nil {
+			app.logger.Errorw("error evicting cached user", "user", user.ID, "error", err.Error())
+		}
+	}
+
+	if err := app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
+		Status:  true,
+		Message: "Profile updated successfully",
+		Data: map[string]interface{}{
+			"user": user,
+		},
+	}); err != nil {
+		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+}
+
+func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := getUserFromContext(r)
+	toBeFollowedUser := getProfileFromContext(r)
+
+	requested, err := app.store.Followers.Follow(r.Context(), user.ID, toBeFollowedUser.ID)
+	if err != nil {
 		switch {
 		case errors.Is(err, store.ErrSelfFollow):
 			_ = app.WriteError(w, r, http.StatusConflict, err)
@@ -46,12 +184,36 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 		case errors.Is(err, store.ErrDuplicateFollow):
 			_ = app.WriteError(w, r, http.StatusConflict, err)
 			return
+		case errors.Is(err, store.ErrBlocked):
+			_ = app.WriteError(w, r, http.StatusForbidden, err)
+			return
 		default:
 			_ = app.WriteError(w, r, http.StatusInternalServerError, err)
 			return
 		}
 	}
 
+	kind := store.NotificationFollow
+	if requested {
+		kind = store.NotificationFollowRequest
+	} else {
+		app.invalidateTimelines(r.Context(), user.ID)
+	}
+
+	app.notify(r.Context(), &store.Notification{
+		UserID:  toBeFollowedUser.ID,
+		ActorID: user.ID,
+		Kind:    kind,
+	})
+
+	if requested {
+		_ = app.WriteJSON(w, r, http.StatusAccepted, types.APIResponseBody{
+			Status:  true,
+			Message: "Follow request sent",
+		})
+		return
+	}
+
 	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
 		Status:  true,
 		Message: "User followed successfully",
@@ -61,18 +223,15 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 
 func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
 	user := getUserFromContext(r)
+	toBeUnfollowedUser := getProfileFromContext(r)
 
-	toBeUnfollowedUser, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
-	if err != nil {
-		_ = app.WriteError(w, r, http.StatusBadRequest, err)
-		return
-	}
-
-	if err := app.store.Followers.Unfollow(r.Context(), user.ID, toBeUnfollowedUser); err != nil {
+	if err := app.store.Followers.Unfollow(r.Context(), user.ID, toBeUnfollowedUser.ID); err != nil {
 		_ = app.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
+	app.invalidateTimelines(r.Context(), user.ID)
+
 	_ = app.WriteJSON(w, r, http.StatusOK, types.APIResponseBody{
 		Status:  true,
 		Message: "successful",
@@ -105,6 +264,47 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 	return
 }
 
+type ResendActivationPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+func (app *application) resendActivationHandler(w http.ResponseWriter, r *http.Request) {
+
+	var payload ResendActivationPayload
+	if err := utils.ParseJSON(w, r, &payload); err != nil {
+		_ = app.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := utils.Validate.Struct(&payload); err != nil {
+		_ = app.WriteError(w, r, http.StatusUnprocessableEntity, errors.New("The Email is invalid"))
+		return
+	}
+
+	// every email gets the same answer, as fast, so the endpoint does not
+	// reveal who has an inactive account
+	response := types.APIResponseBody{
+		Status:  true,
+		Message: "If the email belongs to an inactive account, a new activation link has been sent to it",
+	}
+
+	plainToken := uuid.New().String()
+
+	ctx := r.Context()
+	user, err := app.store.Users.ReissueInvitation(ctx, payload.Email, hashToken(plainToken), app.config.mail.OTPExpiration)
+	switch {
+	case err == nil:
+		// sent in the background, waiting on the mail server would make
+		// inactive accounts answer slower than unknown emails
+		go app.sendActivationEmail(context.WithoutCancel(ctx), user, plainToken)
+	case !errors.Is(err, store.ErrNotFound):
+		app.logger.Errorw("error reissuing invitation", "error", err.Error())
+	}
+
+	_ = app.WriteJSON(w, r, http.StatusOK, response)
+	return
+}
+
 func (app *application) userContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
@@ -126,7 +326,14 @@ func (app *application) userContextMiddleware(next http.Handler) http.Handler {
 			}
 		}
 
-		ctx = context.WithValue(ctx, userCtxKey, user)
+		// accounts that were never activated have no public profile, the
+		// same as when they are looked up by username
+		if !user.EmailVerifiedAt.Valid {
+			_ = app.WriteError(w, r, http.StatusNotFound, store.ErrNotFound)
+			return
+		}
+
+		ctx = context.WithValue(ctx, profileCtxKey, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -135,3 +342,21 @@ func getUserFromContext(r *http.Request) *store.User {
 	user, _ := r.Context().Value(userCtxKey).(*store.User)
 	return user
 }
+
+func getProfileFromContext(r *http.Request) *store.User {
+	user, _ := r.Context().Value(profileCtxKey).(*store.User)
+	return user
+}
+
+// getSessionFromContext returns the token family the current access token
+// was issued for.
+func getSessionFromContext(r *http.Request) string {
+	session, _ := r.Context().Value(sessionCtxKey).(string)
+	return session
+}
+
+// getTokenExpiryFromContext returns when the current access token expires.
+func getTokenExpiryFromContext(r *http.Request) time.Time {
+	expiry, _ := r.Context().Value(tokenExpiryCtxKey).(time.Time)
+	return expiry
+}
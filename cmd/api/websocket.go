@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/nnxmxni/gophersocial/internals/store"
+	"golang.org/x/net/websocket"
+	"net/http"
+	"time"
+)
+
+// socketWriteTimeout bounds every frame written to a socket, a client that
+// stops reading is dropped instead of holding the handler forever.
+const socketWriteTimeout = time.Second * 10
+
+// socketEvent is a frame sent to the client, Event names what Data holds.
+type socketEvent struct {
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// conversationsSocketHandler upgrades to a WebSocket delivering the
+// messages and read receipts of every conversation of the user as they
+// happen. The socket only pushes, everything else goes through the REST
+// endpoints.
+func (app *application) conversationsSocketHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := getUserFromContext(r)
+	session := getSessionFromContext(r)
+	expiresAt := getTokenExpiryFromContext(r)
+
+	server := websocket.Server{
+		Handshake: app.checkSocketOrigin,
+		Handler: func(ws *websocket.Conn) {
+			app.serveSocket(ws, user, session, expiresAt)
+		},
+	}
+
+	server.ServeHTTP(w, r)
+}
+
+// checkSocketOrigin turns away handshakes sent by pages of other sites,
+// clients that are not browsers send no Origin at all.
+func (app *application) checkSocketOrigin(config *websocket.Config, r *http.Request) error {
+
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == app.config.frontendURL {
+		return nil
+	}
+
+	return fmt.Errorf("origin %s not allowed", origin)
+}
+
+// serveSocket pushes the events of user until the client goes away or the
+// access token the socket was opened with stops being valid. The token is
+// only checked at the handshake, so every heartbeat checks again that it
+// has not expired and that its session was not revoked.
+func (app *application) serveSocket(ws *websocket.Conn, user *store.User, session string, expiresAt time.Time) {
+
+	sub := app.broker.Subscribe(userTopic(user.ID))
+	defer sub.Close()
+
+	// the connection was hijacked with the deadlines of the http server
+	// still set on it
+	if err := ws.SetDeadline(time.Time{}); err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// nothing is expected from the client, reading only notices when it
+	// goes away
+	go func() {
+		defer cancel()
+
+		for {
+			var discard []byte
+			if err := websocket.Message.Receive(ws, &discard); err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(app.config.stream.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		var event socketEvent
+
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-heartbeat.C:
+			if !app.socketSessionValid(ctx, session, expiresAt) {
+				// tell the client why, so it refreshes its token before
+				// reconnecting
+				_ = ws.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+				_ = websocket.JSON.Send(ws, socketEvent{Event: "session_ended"})
+				return
+			}
+
+			event = socketEvent{Event: "heartbeat"}
+
+		case msg, ok := <-sub.C:
+			if !ok {
+				return
+			}
+
+			event = socketEvent{Event: msg.Event, Data: msg.Data}
+		}
+
+		if err := ws.SetWriteDeadline(time.Now().Add(socketWriteTimeout)); err != nil {
+			return
+		}
+
+		if err := websocket.JSON.Send(ws, event); err != nil {
+			return
+		}
+	}
+}
+
+// socketSessionValid tells whether a socket opened with an access token of
+// session expiring at expiresAt may keep delivering events. A failed check
+// closes the socket too, the client reconnects through the handshake.
+func (app *application) socketSessionValid(ctx context.Context, session string, expiresAt time.Time) bool {
+
+	if !time.Now().Before(expiresAt) {
+		return false
+	}
+
+	revoked, err := app.store.RefreshTokens.IsFamilyRevoked(ctx, session)
+	if err != nil {
+		app.logger.Errorw("error checking the session of a socket", "session", session, "error", err.Error())
+		return false
+	}
+
+	return !revoked
+}
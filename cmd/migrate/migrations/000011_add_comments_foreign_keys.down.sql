@@ -0,0 +1,4 @@
+ALTER TABLE comments
+    DROP CONSTRAINT IF EXISTS fk_comments_post,
+    DROP CONSTRAINT IF EXISTS fk_comments_user,
+    DROP COLUMN IF EXISTS updated_at;
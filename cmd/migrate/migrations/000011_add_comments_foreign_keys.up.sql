@@ -0,0 +1,15 @@
+DELETE FROM comments
+WHERE post_id NOT IN (SELECT id FROM posts)
+   OR user_id NOT IN (SELECT id FROM users);
+
+ALTER TABLE comments
+    ALTER COLUMN post_id DROP DEFAULT,
+    ALTER COLUMN user_id DROP DEFAULT;
+
+DROP SEQUENCE IF EXISTS comments_post_id_seq;
+DROP SEQUENCE IF EXISTS comments_user_id_seq;
+
+ALTER TABLE comments
+    ADD COLUMN updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    ADD CONSTRAINT fk_comments_post FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    ADD CONSTRAINT fk_comments_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_one_time_passwords_user_id_purpose;
+
+ALTER TABLE one_time_passwords
+DROP COLUMN purpose;
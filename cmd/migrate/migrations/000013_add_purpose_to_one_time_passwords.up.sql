@@ -0,0 +1,4 @@
+ALTER TABLE one_time_passwords
+    ADD COLUMN purpose varchar(32) NOT NULL DEFAULT 'activation';
+
+CREATE INDEX IF NOT EXISTS idx_one_time_passwords_user_id_purpose ON one_time_passwords (user_id, purpose);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS reactions (
+    post_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    kind varchar(20) NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (post_id, user_id, kind),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT chk_reaction_kind CHECK (kind IN ('like', 'love', 'laugh', 'wow', 'sad', 'angry'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_reactions_user_id ON reactions (user_id);
@@ -0,0 +1,14 @@
+ALTER TABLE users
+    ADD COLUMN username citext,
+    ADD COLUMN display_name varchar(100) NOT NULL DEFAULT '',
+    ADD COLUMN bio text NOT NULL DEFAULT '',
+    ADD COLUMN avatar_url text NOT NULL DEFAULT '';
+
+UPDATE users
+SET username = 'user_' || id
+WHERE username IS NULL;
+
+ALTER TABLE users
+    ALTER COLUMN username SET NOT NULL,
+    ADD CONSTRAINT users_username_key UNIQUE (username),
+    ADD CONSTRAINT chk_users_username CHECK (username ~ '^[A-Za-z0-9_]{3,30}$');
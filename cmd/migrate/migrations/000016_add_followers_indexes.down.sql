@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_followers_user_id_created_at;
+
+DROP INDEX IF EXISTS idx_followers_follower_id_created_at;
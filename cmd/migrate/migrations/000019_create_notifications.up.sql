@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS notifications (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    actor_id bigint NOT NULL,
+    kind varchar(32) NOT NULL,
+    post_id bigint,
+    comment_id bigint,
+    read_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE,
+    CONSTRAINT chk_notification_kind CHECK (kind IN ('follow', 'follow_request', 'comment', 'mention', 'reaction')),
+    CONSTRAINT chk_notification_not_self CHECK (user_id != actor_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id_created_at ON notifications (user_id, created_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id_unread ON notifications (user_id) WHERE read_at IS NULL;
+
+-- following or reacting again, e.g. after an unfollow or with another kind
+-- of reaction, does not notify twice
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_once
+    ON notifications (user_id, actor_id, kind, COALESCE(post_id, 0))
+    WHERE kind IN ('follow', 'follow_request', 'reaction');
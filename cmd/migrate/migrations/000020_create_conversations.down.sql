@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS messages;
+
+DROP TABLE IF EXISTS conversation_participants;
+
+DROP TABLE IF EXISTS conversations;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS messages_followers_only;
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_users_email_lower;
+
+DROP INDEX IF EXISTS idx_users_username_prefix;
+
+CREATE INDEX IF NOT EXISTS idx_posts_title ON posts USING gin (title gin_trgm_ops);
+
+DROP INDEX IF EXISTS idx_posts_search_vector;
+
+ALTER TABLE posts
+    DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,15 @@
+-- titles weigh more than content when ranking
+ALTER TABLE posts
+    ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(content, '')), 'B')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_posts_search_vector ON posts USING gin (search_vector);
+
+-- the trigram index only ever served the ILIKE search the tsvector replaces
+DROP INDEX IF EXISTS idx_posts_title;
+
+CREATE INDEX IF NOT EXISTS idx_users_username_prefix ON users (lower(username::text) text_pattern_ops);
+
+CREATE INDEX IF NOT EXISTS idx_users_email_lower ON users (lower(email::text));
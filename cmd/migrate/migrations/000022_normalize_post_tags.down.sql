@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_posts_created_at;
+
+ALTER TABLE posts
+    ALTER COLUMN tags DROP NOT NULL,
+    ALTER COLUMN tags DROP DEFAULT;
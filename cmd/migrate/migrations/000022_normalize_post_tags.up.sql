@@ -0,0 +1,17 @@
+-- existing tags get the rules new ones are held to: lowercase, without a
+-- leading '#', deduplicated, and dropped when they are not a valid tag
+UPDATE posts p
+SET tags = ARRAY(
+    SELECT DISTINCT lower(btrim(t, ' #'))
+    FROM unnest(p.tags) AS t
+    WHERE lower(btrim(t, ' #')) ~ '^[[:alnum:]_]{1,50}$'
+)
+WHERE p.tags IS NOT NULL;
+
+UPDATE posts SET tags = '{}' WHERE tags IS NULL;
+
+ALTER TABLE posts
+    ALTER COLUMN tags SET DEFAULT '{}',
+    ALTER COLUMN tags SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts (created_at);
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_posts_unpublished;
+DROP INDEX IF EXISTS idx_posts_scheduled;
+
+-- unpublished posts did not exist before, they would show up as published
+DELETE FROM posts WHERE status != 'published';
+
+ALTER TABLE posts
+    DROP CONSTRAINT IF EXISTS chk_post_scheduled_publish_at,
+    DROP CONSTRAINT IF EXISTS chk_post_status,
+    DROP COLUMN IF EXISTS publish_at,
+    DROP COLUMN IF EXISTS status;
@@ -0,0 +1,9 @@
+ALTER TABLE posts
+    ADD COLUMN status varchar(20) NOT NULL DEFAULT 'published',
+    ADD COLUMN publish_at timestamp(0) with time zone,
+    ADD CONSTRAINT chk_post_status CHECK (status IN ('draft', 'scheduled', 'published')),
+    ADD CONSTRAINT chk_post_scheduled_publish_at CHECK (status != 'scheduled' OR publish_at IS NOT NULL);
+
+-- the scheduler only ever looks for the scheduled posts that are due
+CREATE INDEX IF NOT EXISTS idx_posts_scheduled ON posts (publish_at) WHERE status = 'scheduled';
+CREATE INDEX IF NOT EXISTS idx_posts_unpublished ON posts (user_id, created_at) WHERE status != 'published';
@@ -0,0 +1,17 @@
+-- a revision holds what a post looked like before one of its edits
+CREATE TABLE IF NOT EXISTS post_revisions (
+    id bigserial PRIMARY KEY,
+    post_id bigint NOT NULL,
+    editor_id bigint,
+    title text NOT NULL,
+    content text NOT NULL,
+    tags varchar [] NOT NULL DEFAULT '{}',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (editor_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_revisions_post_id ON post_revisions (post_id, created_at);
+
+ALTER TABLE posts ADD COLUMN edited_at timestamp(0) with time zone;
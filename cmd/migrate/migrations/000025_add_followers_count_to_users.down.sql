@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS followers_count ON followers;
+
+DROP FUNCTION IF EXISTS update_followers_count();
+
+ALTER TABLE users DROP COLUMN IF EXISTS followers_count;
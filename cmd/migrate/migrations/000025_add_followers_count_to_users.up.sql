@@ -0,0 +1,22 @@
+-- kept by a trigger rather than by the store, follows also go away when a
+-- block or a deleted account removes them
+ALTER TABLE users ADD COLUMN followers_count bigint NOT NULL DEFAULT 0;
+
+UPDATE users u
+SET followers_count = (SELECT COUNT(*) FROM followers f WHERE f.user_id = u.id);
+
+CREATE OR REPLACE FUNCTION update_followers_count() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE users SET followers_count = followers_count + 1 WHERE id = NEW.user_id;
+    ELSE
+        UPDATE users SET followers_count = followers_count - 1 WHERE id = OLD.user_id;
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER followers_count
+AFTER INSERT OR DELETE ON followers
+FOR EACH ROW EXECUTE FUNCTION update_followers_count();
@@ -6,3 +6,9 @@ type Authenticator interface {
 	GenerateToken(claims jwt.Claims) (string, error)
 	ValidateToken(token string) (*jwt.Token, error)
 }
+
+// KeyPublisher is implemented by authenticators whose verification keys can
+// be shared with other services.
+type KeyPublisher interface {
+	JWKS() JWKSet
+}
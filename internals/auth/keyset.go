@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrUnknownKey     = errors.New("unknown signing key")
+	ErrKeyCannotSign  = errors.New("signing key has no private part")
+	ErrUnsupportedKey = errors.New("unsupported key type")
+	ErrNoActiveKey    = errors.New("no active signing key")
+	ErrMissingKeyID   = errors.New("token has no kid header")
+)
+
+// signingKey is a single entry of the key set. Retired keys may only carry
+// the public part, they are kept around so tokens signed with them still
+// validate until they expire.
+type signingKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+// KeySetAuthenticator signs tokens with an asymmetric key (RS256 or EdDSA)
+// and validates them against every key it knows, selected by the kid header.
+type KeySetAuthenticator struct {
+	sync.RWMutex
+	keys   map[string]*signingKey
+	active string
+	iss    string
+	aud    string
+}
+
+func NewKeySetAuthenticator(iss, aud string) *KeySetAuthenticator {
+	return &KeySetAuthenticator{
+		keys: make(map[string]*signingKey),
+		iss:  iss,
+		aud:  aud,
+	}
+}
+
+// LoadKeysFromDir adds every *.pem file in dir to the key set, using the file
+// name without its extension as the kid.
+func (a *KeySetAuthenticator) LoadKeysFromDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		kid := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		if err := a.AddKeyFromFile(kid, file); err != nil {
+			return fmt.Errorf("loading key %s: %w", kid, err)
+		}
+	}
+
+	return nil
+}
+
+// AddKeyFromFile reads a PEM encoded RSA or Ed25519 key. Private keys can
+// sign and validate, public keys can only validate.
+func (a *KeySetAuthenticator) AddKeyFromFile(kid, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	key, err := parseKey(kid, data)
+	if err != nil {
+		return err
+	}
+
+	a.Lock()
+	a.keys[kid] = key
+	a.Unlock()
+
+	return nil
+}
+
+// Rotate makes kid the key new tokens are signed with. Tokens signed by the
+// previous key keep validating as long as it stays in the set.
+func (a *KeySetAuthenticator) Rotate(kid string) error {
+	a.Lock()
+	defer a.Unlock()
+
+	key, ok := a.keys[kid]
+	if !ok {
+		return ErrUnknownKey
+	}
+
+	if key.private == nil {
+		return ErrKeyCannotSign
+	}
+
+	a.active = kid
+
+	return nil
+}
+
+func (a *KeySetAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
+	a.RLock()
+	key, ok := a.keys[a.active]
+	a.RUnlock()
+
+	if !ok {
+		return "", ErrNoActiveKey
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+
+	return token.SignedString(key.private)
+}
+
+func (a *KeySetAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
+	return jwt.Parse(token, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" {
+			return nil, ErrMissingKeyID
+		}
+
+		a.RLock()
+		key, ok := a.keys[kid]
+		a.RUnlock()
+
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+
+		if t.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+
+		return key.public, nil
+	},
+		jwt.WithExpirationRequired(),
+		jwt.WithAudience(a.aud),
+		jwt.WithIssuer(a.iss),
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+	)
+}
+
+// JWK is the public part of a key as described by RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS publishes the public keys of the whole set, so other services can
+// verify tokens signed by any key that has not been removed yet.
+func (a *KeySetAuthenticator) JWKS() JWKSet {
+	a.RLock()
+	defer a.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+
+	for _, key := range a.keys {
+		jwk := JWK{
+			Kid: key.id,
+			Use: "sig",
+			Alg: key.method.Alg(),
+		}
+
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+func parseKey(kid string, data []byte) (*signingKey, error) {
+	if private, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+		return &signingKey{id: kid, method: jwt.SigningMethodRS256, private: private, public: &private.PublicKey}, nil
+	}
+
+	if private, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+		public := private.(ed25519.PrivateKey).Public()
+		return &signingKey{id: kid, method: jwt.SigningMethodEdDSA, private: private, public: public}, nil
+	}
+
+	if public, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		return &signingKey{id: kid, method: jwt.SigningMethodRS256, public: public}, nil
+	}
+
+	if public, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+		return &signingKey{id: kid, method: jwt.SigningMethodEdDSA, public: public}, nil
+	}
+
+	return nil, ErrUnsupportedKey
+}
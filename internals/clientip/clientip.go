@@ -0,0 +1,162 @@
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// The forwarding headers a Resolver can read.
+const (
+	HeaderXForwardedFor = "X-Forwarded-For"
+	HeaderForwarded     = "Forwarded"
+)
+
+// Resolver finds the address of the client behind a chain of proxies. Only
+// hops added by trusted proxies are believed: the forwarding header is
+// walked from the right and the first address that is not a trusted proxy
+// is the client, anything to its left may have been forged by the client.
+//
+// Only the one header the trusted proxies write is read. Proxies pass the
+// headers they do not write through untouched, so any other one holds
+// whatever the client sent.
+type Resolver struct {
+	trusted []netip.Prefix
+	header  string
+}
+
+// NewResolver parses the CIDRs of the trusted proxies, a bare address is
+// treated as a single host. header is the forwarding header those proxies
+// write, either HeaderXForwardedFor or HeaderForwarded.
+func NewResolver(cidrs []string, header string) (*Resolver, error) {
+	resolver := &Resolver{header: http.CanonicalHeaderKey(header)}
+
+	if resolver.header != HeaderXForwardedFor && resolver.header != HeaderForwarded {
+		return nil, fmt.Errorf("unsupported forwarding header: %s", header)
+	}
+
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, err
+			}
+
+			resolver.trusted = append(resolver.trusted, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+
+		resolver.trusted = append(resolver.trusted, prefix.Masked())
+	}
+
+	return resolver, nil
+}
+
+// ClientIP returns the address of the client that sent r.
+func (res *Resolver) ClientIP(r *http.Request) string {
+	remote, ok := parseAddr(r.RemoteAddr)
+	if !ok {
+		return r.RemoteAddr
+	}
+
+	if !res.isTrusted(remote) {
+		return remote.String()
+	}
+
+	var hops []string
+	switch res.header {
+	case HeaderForwarded:
+		hops = forwardedFor(r.Header.Values(HeaderForwarded))
+	default:
+		hops = xForwardedFor(r.Header.Values(HeaderXForwardedFor))
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseAddr(hops[i])
+		if !ok {
+			// a trusted proxy wrote something we cannot use, the last
+			// address we could verify is the best we have
+			break
+		}
+
+		client = addr
+		if !res.isTrusted(addr) {
+			break
+		}
+	}
+
+	return client.String()
+}
+
+func (res *Resolver) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range res.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func xForwardedFor(headers []string) []string {
+	var hops []string
+
+	for _, header := range headers {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+
+	return hops
+}
+
+// forwardedFor extracts the for= parameter of every element of RFC 7239
+// Forwarded headers, e.g. `for=192.0.2.60;proto=http, for="[2001:db8::1]:4711"`.
+func forwardedFor(headers []string) []string {
+	var hops []string
+
+	for _, header := range headers {
+		for _, element := range strings.Split(header, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if !found || !strings.EqualFold(key, "for") {
+					continue
+				}
+
+				hops = append(hops, strings.Trim(value, `"`))
+			}
+		}
+	}
+
+	return hops
+}
+
+// parseAddr accepts an address with or without a port, IPv6 addresses may
+// be wrapped in brackets.
+func parseAddr(value string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	return addr.Unmap(), true
+}
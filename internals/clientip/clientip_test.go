@@ -0,0 +1,126 @@
+package clientip
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{
+			name:       "no forwarding header",
+			header:     HeaderXForwardedFor,
+			remoteAddr: "10.0.0.1:5000",
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "forged Forwarded next to the real X-Forwarded-For",
+			header:     HeaderXForwardedFor,
+			remoteAddr: "10.0.0.1:5000",
+			headers: map[string]string{
+				"Forwarded":       "for=1.2.3.4",
+				"X-Forwarded-For": "203.0.113.7",
+			},
+			want: "203.0.113.7",
+		},
+		{
+			name:       "forged X-Forwarded-For next to the real Forwarded",
+			header:     HeaderForwarded,
+			remoteAddr: "10.0.0.1:5000",
+			headers: map[string]string{
+				"Forwarded":       "for=203.0.113.7;proto=https",
+				"X-Forwarded-For": "1.2.3.4",
+			},
+			want: "203.0.113.7",
+		},
+		{
+			name:       "forged leftmost X-Forwarded-For entry",
+			header:     HeaderXForwardedFor,
+			remoteAddr: "10.0.0.1:5000",
+			headers: map[string]string{
+				"X-Forwarded-For": "1.2.3.4, 203.0.113.7",
+			},
+			want: "203.0.113.7",
+		},
+		{
+			name:       "chain of trusted proxies",
+			header:     HeaderXForwardedFor,
+			remoteAddr: "10.0.0.1:5000",
+			headers: map[string]string{
+				"X-Forwarded-For": "1.2.3.4, 203.0.113.7, 10.0.0.2",
+			},
+			want: "203.0.113.7",
+		},
+		{
+			name:       "untrusted remote address",
+			header:     HeaderXForwardedFor,
+			remoteAddr: "198.51.100.9:5000",
+			headers: map[string]string{
+				"X-Forwarded-For": "1.2.3.4",
+			},
+			want: "198.51.100.9",
+		},
+		{
+			name:       "IPv6 with brackets and a port in Forwarded",
+			header:     HeaderForwarded,
+			remoteAddr: "10.0.0.1:5000",
+			headers: map[string]string{
+				"Forwarded": `for="[2001:db8::1]:4711"`,
+			},
+			want: "2001:db8::1",
+		},
+		{
+			name:       "IPv6 with brackets and a port in X-Forwarded-For",
+			header:     HeaderXForwardedFor,
+			remoteAddr: "[::ffff:10.0.0.1]:5000",
+			headers: map[string]string{
+				"X-Forwarded-For": "[2001:db8::1]:4711",
+			},
+			want: "2001:db8::1",
+		},
+		{
+			name:       "unparseable hop",
+			header:     HeaderXForwardedFor,
+			remoteAddr: "10.0.0.1:5000",
+			headers: map[string]string{
+				"X-Forwarded-For": "203.0.113.7, unknown",
+			},
+			want: "10.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := NewResolver([]string{"10.0.0.0/8"}, tt.header)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+
+			if got := res.ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewResolverRejectsUnknownHeader(t *testing.T) {
+	if _, err := NewResolver(nil, "X-Real-IP"); err == nil {
+		t.Fatal("a header the resolver cannot read should be rejected")
+	}
+}
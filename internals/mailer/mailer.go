@@ -0,0 +1,129 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"text/template"
+	"time"
+)
+
+const (
+	FromName              = "GopherSocial"
+	UserWelcomeTemplate   = "user_invitation.tmpl"
+	PasswordResetTemplate = "password_reset.tmpl"
+
+	maxRetries   = 3
+	retryBackoff = time.Millisecond * 500
+	// sendTimeout bounds a single attempt, mails are sent from within
+	// requests and transactions that should not wait on a hung server.
+	sendTimeout = time.Second * 10
+)
+
+//go:embed templates
+var FS embed.FS
+
+type Mailer interface {
+	Send(ctx context.Context, templateFile, email string, data any) error
+}
+
+type Config struct {
+	Driver    string
+	FromEmail string
+	SMTP      SMTPConfig
+	Sandbox   SandboxConfig
+}
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+type SandboxConfig struct {
+	// Dir is where rendered emails are written, stdout is used when empty.
+	Dir string
+}
+
+// Message is a rendered email ready to be handed to a transport.
+type Message struct {
+	To        string
+	Subject   string
+	PlainBody string
+	HTMLBody  string
+}
+
+func render(templateFile, email string, data any) (*Message, error) {
+
+	tmpl, err := template.ParseFS(FS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+	if err := tmpl.ExecuteTemplate(subject, "subject", data); err != nil {
+		return nil, err
+	}
+
+	plainBody := new(bytes.Buffer)
+	if err := tmpl.ExecuteTemplate(plainBody, "plainBody", data); err != nil {
+		return nil, err
+	}
+
+	// the html body goes through html/template so user data is escaped
+	htmlTmpl, err := htmltemplate.ParseFS(FS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	if err := htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data); err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		To:        email,
+		Subject:   subject.String(),
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+	}, nil
+}
+
+// withRetry calls send up to maxRetries times, doubling the wait between
+// attempts, and returns the last error if none of them succeeded.
+func withRetry(ctx context.Context, send func() error) error {
+	var err error
+
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		if err = send(); err == nil {
+			return nil
+		}
+
+		if attempt == maxRetries-1 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryBackoff << attempt):
+		}
+	}
+
+	return err
+}
+
+// New returns the mailer selected by cfg.Driver, either "smtp" or "sandbox".
+func New(cfg Config) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return NewSMTPMailer(cfg.FromEmail, cfg.SMTP), nil
+	case "sandbox":
+		return NewSandboxMailer(cfg.FromEmail, cfg.Sandbox), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer driver: %s", cfg.Driver)
+	}
+}
@@ -0,0 +1,69 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SandboxMailer never leaves the machine: emails are written to a directory,
+// one file per message, or to stdout so activation links show up in the logs
+// during local development.
+type SandboxMailer struct {
+	sync.Mutex
+	fromEmail string
+	dir       string
+	out       io.Writer
+}
+
+func NewSandboxMailer(fromEmail string, cfg SandboxConfig) *SandboxMailer {
+	return &SandboxMailer{
+		fromEmail: fromEmail,
+		dir:       cfg.Dir,
+		out:       os.Stdout,
+	}
+}
+
+func (m *SandboxMailer) Send(ctx context.Context, templateFile, email string, data any) error {
+
+	msg, err := render(templateFile, email, data)
+	if err != nil {
+		return err
+	}
+
+	return withRetry(ctx, func() error {
+		return m.write(msg)
+	})
+}
+
+func (m *SandboxMailer) write(msg *Message) error {
+	m.Lock()
+	defer m.Unlock()
+
+	content := fmt.Sprintf(
+		"From: %s <%s>\nTo: %s\nSubject: %s\n\n%s\n",
+		FromName,
+		m.fromEmail,
+		msg.To,
+		msg.Subject,
+		strings.TrimSpace(msg.PlainBody),
+	)
+
+	if m.dir == "" {
+		_, err := io.WriteString(m.out, content)
+		return err
+	}
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d_%s.eml", time.Now().UnixNano(), strings.ReplaceAll(msg.To, "@", "_at_"))
+
+	return os.WriteFile(filepath.Join(m.dir, name), []byte(content), 0o644)
+}
@@ -0,0 +1,142 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net"
+	"net/smtp"
+	"strconv"
+)
+
+type SMTPMailer struct {
+	fromEmail string
+	host      string
+	addr      string
+	auth      smtp.Auth
+}
+
+func NewSMTPMailer(fromEmail string, cfg SMTPConfig) *SMTPMailer {
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+
+	return &SMTPMailer{
+		fromEmail: fromEmail,
+		host:      cfg.Host,
+		addr:      net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		auth:      auth,
+	}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, templateFile, email string, data any) error {
+
+	msg, err := render(templateFile, email, data)
+	if err != nil {
+		return err
+	}
+
+	body := m.encode(msg)
+
+	return withRetry(ctx, func() error {
+		return m.send(ctx, msg.To, body)
+	})
+}
+
+// send does what smtp.SendMail does, within the deadline of ctx and at most
+// sendTimeout. smtp.SendMail takes no context and would wait on a hung
+// server forever.
+func (m *SMTPMailer) send(ctx context.Context, to string, body []byte) error {
+
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", m.addr)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	// the smtp client has no context, the deadline covers the whole exchange
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		return err
+	}
+
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+
+	if m.auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp server does not support AUTH")
+		}
+
+		if err := c.Auth(m.auth); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(m.fromEmail); err != nil {
+		return err
+	}
+
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// encode builds a multipart/alternative message so clients that cannot show
+// html fall back to the plain body.
+func (m *SMTPMailer) encode(msg *Message) []byte {
+	boundary := uuid.New().String()
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "From: %s <%s>\r\n", FromName, m.fromEmail)
+	fmt.Fprintf(buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(buf, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	fmt.Fprintf(buf, "--%s\r\n", boundary)
+	fmt.Fprintf(buf, "Content-Type: text/plain; charset=\"UTF-8\"\r\n\r\n")
+	fmt.Fprintf(buf, "%s\r\n", msg.PlainBody)
+
+	fmt.Fprintf(buf, "--%s\r\n", boundary)
+	fmt.Fprintf(buf, "Content-Type: text/html; charset=\"UTF-8\"\r\n\r\n")
+	fmt.Fprintf(buf, "%s\r\n", msg.HTMLBody)
+
+	fmt.Fprintf(buf, "--%s--\r\n", boundary)
+
+	return buf.Bytes()
+}
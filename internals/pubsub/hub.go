@@ -0,0 +1,105 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+)
+
+// subscriptionBuffer is how many messages a subscriber may fall behind
+// before new ones are dropped for it, a slow client must not hold up the
+// publisher.
+const subscriptionBuffer = 64
+
+type Subscription struct {
+	C <-chan Message
+
+	ch    chan Message
+	topic string
+	hub   *Hub
+	once  sync.Once
+}
+
+// Close unsubscribes, it is safe to call more than once.
+func (s *Subscription) Close() {
+	s.hub.remove(s)
+}
+
+// Hub is an in-process broker, messages only reach subscribers of the
+// same replica.
+type Hub struct {
+	mu     sync.RWMutex
+	topics map[string]map[*Subscription]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		topics: make(map[string]map[*Subscription]struct{}),
+	}
+}
+
+func (h *Hub) Publish(_ context.Context, topic string, msg Message) error {
+	h.dispatch(topic, msg)
+	return nil
+}
+
+func (h *Hub) Subscribe(topic string) *Subscription {
+	ch := make(chan Message, subscriptionBuffer)
+	sub := &Subscription{
+		C:     ch,
+		ch:    ch,
+		topic: topic,
+		hub:   h,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.topics[topic] == nil {
+		h.topics[topic] = make(map[*Subscription]struct{})
+	}
+	h.topics[topic][sub] = struct{}{}
+
+	return sub
+}
+
+func (h *Hub) Run(ctx context.Context) error {
+	<-ctx.Done()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for topic, subs := range h.topics {
+		for sub := range subs {
+			sub.once.Do(func() { close(sub.ch) })
+		}
+		delete(h.topics, topic)
+	}
+
+	return nil
+}
+
+func (h *Hub) dispatch(topic string, msg Message) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.topics[topic] {
+		select {
+		case sub.ch <- msg:
+		default:
+		}
+	}
+}
+
+func (h *Hub) remove(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if subs, ok := h.topics[sub.topic]; ok {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(h.topics, sub.topic)
+		}
+	}
+
+	sub.once.Do(func() { close(sub.ch) })
+}
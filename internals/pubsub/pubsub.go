@@ -0,0 +1,38 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis/v8"
+)
+
+// Message is what gets delivered to the subscribers of a topic. ID and
+// Event map to the fields of the same name in a server-sent event.
+type Message struct {
+	ID    string          `json:"id"`
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+type Broker interface {
+	// Publish delivers msg to every subscriber of topic, on every replica
+	// when the broker is shared.
+	Publish(ctx context.Context, topic string, msg Message) error
+	Subscribe(topic string) *Subscription
+	// Run blocks until ctx is done, then closes every subscription so
+	// long lived streams end with the server.
+	Run(ctx context.Context) error
+}
+
+// New returns a broker fanning out through Redis when rdb is set, so
+// subscribers on any replica see what is published on the others, or an
+// in-process one otherwise.
+func New(rdb *redis.Client) Broker {
+	hub := NewHub()
+
+	if rdb == nil {
+		return hub
+	}
+
+	return NewRedisBroker(rdb, hub)
+}
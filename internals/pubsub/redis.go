@@ -0,0 +1,60 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis/v8"
+	"strings"
+)
+
+// channelPrefix namespaces the Redis channels, the topic follows it.
+const channelPrefix = "pubsub:"
+
+// RedisBroker publishes through Redis and hands whatever comes back from it
+// to a local hub, so every replica delivers to its own subscribers.
+type RedisBroker struct {
+	rdb *redis.Client
+	hub *Hub
+}
+
+func NewRedisBroker(rdb *redis.Client, hub *Hub) *RedisBroker {
+	return &RedisBroker{
+		rdb: rdb,
+		hub: hub,
+	}
+}
+
+func (b *RedisBroker) Publish(ctx context.Context, topic string, msg Message) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	return b.rdb.Publish(ctx, channelPrefix+topic, payload).Err()
+}
+
+func (b *RedisBroker) Subscribe(topic string) *Subscription {
+	return b.hub.Subscribe(topic)
+}
+
+// Run relays the Redis channels to the hub. The underlying connection is
+// re-established by the client whenever it drops.
+func (b *RedisBroker) Run(ctx context.Context) error {
+	pubsub := b.rdb.PSubscribe(ctx, channelPrefix+"*")
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+
+	go func() {
+		for m := range messages {
+			var msg Message
+			if err := json.Unmarshal([]byte(m.Payload), &msg); err != nil {
+				continue
+			}
+
+			b.hub.dispatch(strings.TrimPrefix(m.Channel, channelPrefix), msg)
+		}
+	}()
+
+	return b.hub.Run(ctx)
+}
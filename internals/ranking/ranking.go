@@ -0,0 +1,72 @@
+package ranking
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+var (
+	ErrInvalidWeights = errors.New("ranking weights cannot be negative and the half-life must be positive")
+)
+
+// Weights tune how the signals of a post add up to its score.
+type Weights struct {
+	// HalfLife is the age at which a post scores half of what it scored
+	// when it was created, engagement aside.
+	HalfLife time.Duration
+	// Comments and Affinity weigh the comments on the post and the past
+	// interactions of the viewer with its author. Both counts are taken on
+	// a log scale so a viral post does not bury everything else.
+	Comments float64
+	Affinity float64
+	// SecondDegree scales the score of a post whose author the viewer does
+	// not follow but some account they follow does. Zero leaves those posts
+	// out of the feed.
+	SecondDegree float64
+}
+
+// Signals are what is known of a post when ranking it for a viewer.
+type Signals struct {
+	Age          time.Duration
+	Comments     int64
+	Interactions int64
+	SecondDegree bool
+}
+
+func DefaultWeights() Weights {
+	return Weights{
+		HalfLife:     time.Hour * 12,
+		Comments:     1,
+		Affinity:     2,
+		SecondDegree: 0.5,
+	}
+}
+
+func (w Weights) Validate() error {
+	if w.HalfLife <= 0 || w.Comments < 0 || w.Affinity < 0 || w.SecondDegree < 0 {
+		return ErrInvalidWeights
+	}
+
+	return nil
+}
+
+// Score is the recency decay of the post times its engagement, a post with
+// no comments from an author the viewer never interacted with scores its
+// decay alone. Posts from the future, clock skew between servers, are
+// treated as brand new.
+func (w Weights) Score(s Signals) float64 {
+
+	decay := math.Exp2(-max(s.Age, 0).Hours() / w.HalfLife.Hours())
+
+	engagement := 1 +
+		w.Comments*math.Log1p(float64(max(s.Comments, 0))) +
+		w.Affinity*math.Log1p(float64(max(s.Interactions, 0)))
+
+	score := decay * engagement
+	if s.SecondDegree {
+		score *= w.SecondDegree
+	}
+
+	return score
+}
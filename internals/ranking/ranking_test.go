@@ -0,0 +1,125 @@
+package ranking
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestScoreDecaysByHalfLife(t *testing.T) {
+	w := DefaultWeights()
+
+	fresh := w.Score(Signals{})
+	if !almostEqual(fresh, 1) {
+		t.Fatalf("a new post without engagement should score 1, got %v", fresh)
+	}
+
+	tests := []struct {
+		age  time.Duration
+		want float64
+	}{
+		{age: w.HalfLife, want: 0.5},
+		{age: 2 * w.HalfLife, want: 0.25},
+		{age: w.HalfLife / 2, want: 1 / math.Sqrt2},
+		{age: -time.Hour, want: 1},
+	}
+
+	for _, tt := range tests {
+		if got := w.Score(Signals{Age: tt.age}); !almostEqual(got, tt.want) {
+			t.Errorf("Score(age %v) = %v, want %v", tt.age, got, tt.want)
+		}
+	}
+}
+
+func TestScoreRewardsEngagement(t *testing.T) {
+	w := DefaultWeights()
+
+	base := Signals{Age: time.Hour}
+	commented := Signals{Age: time.Hour, Comments: 10}
+	familiar := Signals{Age: time.Hour, Interactions: 10}
+
+	if w.Score(commented) <= w.Score(base) {
+		t.Errorf("comments should raise the score")
+	}
+
+	if w.Score(familiar) <= w.Score(commented) {
+		t.Errorf("with the default weights affinity should count more than as many comments")
+	}
+
+	// the log scale keeps ten times the comments from scoring ten times more
+	viral := Signals{Age: time.Hour, Comments: 100}
+	if ratio := w.Score(viral) / w.Score(commented); ratio >= 2 {
+		t.Errorf("100 comments should score less than twice 10 comments, ratio %v", ratio)
+	}
+
+	negative := Signals{Age: time.Hour, Comments: -5, Interactions: -5}
+	if !almostEqual(w.Score(negative), w.Score(base)) {
+		t.Errorf("negative counts should be treated as zero")
+	}
+}
+
+func TestScoreSecondDegree(t *testing.T) {
+	w := DefaultWeights()
+
+	first := Signals{Age: time.Hour, Comments: 3}
+	second := first
+	second.SecondDegree = true
+
+	if got, want := w.Score(second), w.Score(first)*w.SecondDegree; !almostEqual(got, want) {
+		t.Errorf("second degree score = %v, want %v", got, want)
+	}
+}
+
+func TestScoreRecencyBeatsStaleEngagement(t *testing.T) {
+	w := DefaultWeights()
+
+	recent := Signals{Age: time.Hour}
+	stale := Signals{Age: 7 * 24 * time.Hour, Comments: 50, Interactions: 20}
+
+	if w.Score(stale) >= w.Score(recent) {
+		t.Errorf("a week old post should not outrank a new one, %v >= %v", w.Score(stale), w.Score(recent))
+	}
+}
+
+func TestZeroWeightsIgnoreSignals(t *testing.T) {
+	w := Weights{HalfLife: time.Hour}
+
+	if got := w.Score(Signals{Comments: 100, Interactions: 100}); !almostEqual(got, 1) {
+		t.Errorf("zero weights should ignore engagement, got %v", got)
+	}
+
+	if got := w.Score(Signals{SecondDegree: true}); got != 0 {
+		t.Errorf("a zero second degree weight should hide those posts, got %v", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights Weights
+		valid   bool
+	}{
+		{name: "defaults", weights: DefaultWeights(), valid: true},
+		{name: "zero half-life", weights: Weights{SecondDegree: 1}, valid: false},
+		{name: "negative comments", weights: Weights{HalfLife: time.Hour, Comments: -1}, valid: false},
+		{name: "negative affinity", weights: Weights{HalfLife: time.Hour, Affinity: -1}, valid: false},
+		{name: "negative second degree", weights: Weights{HalfLife: time.Hour, SecondDegree: -1}, valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.weights.Validate()
+			if tt.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if !tt.valid && err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -5,44 +5,73 @@ import (
 	"time"
 )
 
+type fixedWindow struct {
+	count   int
+	resetAt time.Time
+}
+
 type FixedWindowRateLimiter struct {
 	sync.RWMutex
-	clients map[string]int
+	clients map[string]*fixedWindow
 	limits  int
 	window  time.Duration
 }
 
+// NewFixedWindowRateLimiter returns a limiter along with the one goroutine
+// that sweeps its expired windows, for as long as the process runs.
 func NewFixedWindowRateLimiter(limits int, window time.Duration) *FixedWindowRateLimiter {
-	return &FixedWindowRateLimiter{
-		clients: make(map[string]int),
+	rl := &FixedWindowRateLimiter{
+		clients: make(map[string]*fixedWindow),
 		limits:  limits,
 		window:  window,
 	}
+
+	go rl.sweep()
+
+	return rl
 }
 
-func (rl *FixedWindowRateLimiter) Allow(ip string) (bool, time.Duration) {
+func (rl *FixedWindowRateLimiter) Allow(key string) Result {
 	rl.Lock()
-	count, exists := rl.clients[ip]
-	rl.Unlock()
+	defer rl.Unlock()
 
-	if !exists || count < rl.limits {
-		rl.Lock()
-		if !exists {
-			rl.clients[ip] = 0
-			go rl.resetCount(ip)
-		}
+	now := time.Now()
 
-		rl.clients[ip]++
-		rl.Unlock()
-		return true, 0
+	// a window the sweeper did not get to yet is over all the same
+	client, exists := rl.clients[key]
+	if !exists || !now.Before(client.resetAt) {
+		client = &fixedWindow{resetAt: now.Add(rl.window)}
+		rl.clients[key] = client
+	}
+
+	result := Result{
+		Limit: rl.limits,
+		Reset: client.resetAt.Sub(now),
 	}
 
-	return false, rl.window
+	if client.count < rl.limits {
+		client.count++
+		result.Allowed = true
+	}
+
+	result.Remaining = rl.limits - client.count
+
+	return result
 }
 
-func (rl *FixedWindowRateLimiter) resetCount(ip string) {
-	time.Sleep(rl.window)
-	rl.Lock()
-	delete(rl.clients, ip)
-	rl.Unlock()
+// sweep drops the windows that are over, once per window, so the keys of
+// clients that went away do not pile up.
+func (rl *FixedWindowRateLimiter) sweep() {
+	ticker := time.NewTicker(max(rl.window, time.Second))
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		rl.Lock()
+		for key, client := range rl.clients {
+			if !now.Before(client.resetAt) {
+				delete(rl.clients, key)
+			}
+		}
+		rl.Unlock()
+	}
 }
@@ -1,13 +1,72 @@
 package ratelimiter
 
-import "time"
+import (
+	"github.com/go-redis/redis/v8"
+	"time"
+)
+
+const (
+	StrategyFixedWindow   = "fixed-window"
+	StrategySlidingWindow = "sliding-window"
+	StrategyTokenBucket   = "token-bucket"
+)
+
+// Result describes the decision for a single request along with what is
+// needed to fill the RateLimit-* response headers.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the budget is fully available again when the
+	// request was allowed, or until the next request can pass when it was not.
+	Reset time.Duration
+}
 
 type Limiter interface {
-	Allow(ip string) (bool, time.Duration)
+	Allow(key string) Result
 }
 
-type Config struct {
+// Policy is a named budget, e.g. a strict one for login attempts and a
+// looser one for reads.
+type Policy struct {
 	RequestPerTimeFrame int
 	TimeFrame           time.Duration
-	Enabled             bool
+}
+
+type Config struct {
+	Enabled  bool
+	Strategy string
+	Policies map[string]Policy
+}
+
+// New returns a limiter for every policy in cfg, using the strategy it
+// selects. The Redis backed strategies share their counts between replicas
+// and fall back to an in-memory fixed window whenever Redis cannot be
+// reached, so a Redis outage degrades limits to per-replica instead of
+// failing requests.
+func New(cfg Config, rdb *redis.Client) map[string]Limiter {
+	limiters := make(map[string]Limiter, len(cfg.Policies))
+
+	for name, policy := range cfg.Policies {
+		limiters[name] = newLimiter(cfg.Strategy, policy, rdb)
+	}
+
+	return limiters
+}
+
+func newLimiter(strategy string, policy Policy, rdb *redis.Client) Limiter {
+	fallback := NewFixedWindowRateLimiter(policy.RequestPerTimeFrame, policy.TimeFrame)
+
+	if rdb == nil {
+		return fallback
+	}
+
+	switch strategy {
+	case StrategySlidingWindow:
+		return NewRedisSlidingWindowRateLimiter(rdb, policy.RequestPerTimeFrame, policy.TimeFrame, fallback)
+	case StrategyTokenBucket:
+		return NewRedisTokenBucketRateLimiter(rdb, policy.RequestPerTimeFrame, policy.TimeFrame, fallback)
+	default:
+		return fallback
+	}
 }
@@ -0,0 +1,78 @@
+package ratelimiter
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"time"
+)
+
+// redisTimeout bounds every round trip to Redis, past it the request is
+// decided by the in-memory fallback instead of waiting on a dead server.
+const redisTimeout = time.Millisecond * 200
+
+// slidingWindowScript keeps one sorted set entry per request scored by its
+// time in milliseconds. Entries older than the window are dropped before
+// counting, so the limit holds over any window-long period.
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, 0, now - window)
+
+local allowed = 0
+local count = redis.call('ZCARD', key)
+
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	redis.call('PEXPIRE', key, window)
+	allowed = 1
+	count = count + 1
+end
+
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+return {allowed, limit - count, window - (now - tonumber(oldest[2]))}
+`)
+
+type RedisSlidingWindowRateLimiter struct {
+	rdb      *redis.Client
+	limits   int
+	window   time.Duration
+	fallback Limiter
+}
+
+func NewRedisSlidingWindowRateLimiter(rdb *redis.Client, limits int, window time.Duration, fallback Limiter) *RedisSlidingWindowRateLimiter {
+	return &RedisSlidingWindowRateLimiter{
+		rdb:      rdb,
+		limits:   limits,
+		window:   window,
+		fallback: fallback,
+	}
+}
+
+func (rl *RedisSlidingWindowRateLimiter) Allow(key string) Result {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	res, err := slidingWindowScript.Run(
+		ctx,
+		rl.rdb,
+		[]string{"ratelimit:sw:" + key},
+		time.Now().UnixMilli(),
+		rl.window.Milliseconds(),
+		rl.limits,
+		uuid.New().String(),
+	).Int64Slice()
+	if err != nil {
+		return rl.fallback.Allow(key)
+	}
+
+	return Result{
+		Allowed:   res[0] == 1,
+		Limit:     rl.limits,
+		Remaining: int(res[1]),
+		Reset:     time.Duration(res[2]) * time.Millisecond,
+	}
+}
@@ -0,0 +1,91 @@
+package ratelimiter
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"time"
+)
+
+// tokenBucketScript refills the bucket for the time elapsed since the last
+// request before taking a token, which allows short bursts up to the bucket
+// capacity while keeping the average rate.
+var tokenBucketScript = redis.NewScript(`
+local key = KEYS[1]
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+
+local bucket = redis.call('HMGET', key, 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+
+if tokens == nil then
+	tokens = capacity
+	ts = now
+end
+
+tokens = math.min(capacity, tokens + (now - ts) * rate)
+
+local allowed = 0
+local reset = 0
+
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+	reset = math.ceil((capacity - tokens) / rate)
+else
+	reset = math.ceil((1 - tokens) / rate)
+end
+
+redis.call('HSET', key, 'tokens', tokens, 'ts', now)
+redis.call('PEXPIRE', key, ttl)
+
+return {allowed, math.floor(tokens), reset}
+`)
+
+type RedisTokenBucketRateLimiter struct {
+	rdb      *redis.Client
+	capacity int
+	window   time.Duration
+	fallback Limiter
+}
+
+// NewRedisTokenBucketRateLimiter returns a bucket holding capacity tokens
+// that is refilled completely over window.
+func NewRedisTokenBucketRateLimiter(rdb *redis.Client, capacity int, window time.Duration, fallback Limiter) *RedisTokenBucketRateLimiter {
+	return &RedisTokenBucketRateLimiter{
+		rdb:      rdb,
+		capacity: capacity,
+		window:   window,
+		fallback: fallback,
+	}
+}
+
+func (rl *RedisTokenBucketRateLimiter) Allow(key string) Result {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	// tokens refilled per millisecond
+	rate := float64(rl.capacity) / float64(rl.window.Milliseconds())
+
+	res, err := tokenBucketScript.Run(
+		ctx,
+		rl.rdb,
+		[]string{"ratelimit:tb:" + key},
+		rl.capacity,
+		rate,
+		time.Now().UnixMilli(),
+		rl.window.Milliseconds(),
+	).Int64Slice()
+	if err != nil {
+		return rl.fallback.Allow(key)
+	}
+
+	return Result{
+		Allowed:   res[0] == 1,
+		Limit:     rl.capacity,
+		Remaining: int(res[1]),
+		Reset:     time.Duration(res[2]) * time.Millisecond,
+	}
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrSelfBlock = errors.New("user cannot block themselves")
+	ErrBlocked   = errors.New("action not allowed, one of the users has blocked the other")
+)
+
+type BlockStore struct {
+	db *sql.DB
+}
+
+// Block is idempotent. Any follow or follow request between the two users,
+// in either direction, is removed in the same transaction.
+func (s *BlockStore) Block(ctx context.Context, userID int64, toBeBlockedID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+
+		query := `
+			INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1, $2)
+			ON CONFLICT (blocker_id, blocked_id) DO NOTHING
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		_, err := tx.ExecContext(ctx, query, userID, toBeBlockedID)
+		if err != nil {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) {
+				if pqErr.Code == "23514" && pqErr.Constraint == "chk_user_not_self_block" {
+					return ErrSelfBlock
+				}
+			}
+
+			return err
+		}
+
+		query = `
+			DELETE FROM followers
+			WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)
+		`
+
+		_, err = tx.ExecContext(ctx, query, userID, toBeBlockedID)
+		if err != nil {
+			return err
+		}
+
+		query = `
+			DELETE FROM follow_requests
+			WHERE (user_id = $1 AND requester_id = $2) OR (user_id = $2 AND requester_id = $1)
+		`
+
+		_, err = tx.ExecContext(ctx, query, userID, toBeBlockedID)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (s *BlockStore) Unblock(ctx context.Context, userID int64, toBeUnblockedID int64) error {
+
+	query := `DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, toBeUnblockedID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
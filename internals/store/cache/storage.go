@@ -4,17 +4,29 @@ import (
 	"context"
 	"github.com/go-redis/redis/v8"
 	"github.com/nnxmxni/gophersocial/internals/store"
+	"time"
 )
 
 type Storage struct {
 	Users interface {
 		Get(context.Context, int64) (*store.User, error)
 		Set(context.Context, *store.User) error
+		Delete(context.Context, int64) error
+	}
+	Timelines interface {
+		Get(context.Context, int64, *store.Cursor, int) ([]store.FeedEntry, bool, error)
+		Set(context.Context, int64, []store.FeedEntry) error
+		Add(context.Context, []int64, store.FeedEntry) error
+		Remove(context.Context, []int64, int64) error
+		Invalidate(context.Context, ...int64) error
 	}
 }
 
-func NewRedisStorage(rdb *redis.Client) Storage {
+// NewRedisStorage keeps timelines of up to timelineSize posts, dropped when
+// they are not read for timelineTTL.
+func NewRedisStorage(rdb *redis.Client, timelineSize int, timelineTTL time.Duration) Storage {
 	return Storage{
-		Users: &UserStore{rdb: rdb},
+		Users:     &UserStore{rdb: rdb},
+		Timelines: &TimelineStore{rdb: rdb, size: timelineSize, ttl: timelineTTL},
 	}
 }
@@ -0,0 +1,175 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/nnxmxni/gophersocial/internals/store"
+	"strconv"
+	"time"
+)
+
+// fanoutBatch is how many timelines a single script call pushes a post to.
+const fanoutBatch = 500
+
+// timelineAddScript pushes a post to the timelines that exist and trims
+// them to their size. A missing timeline is left missing, it is rebuilt
+// whole from the database on its next read rather than holding only the
+// posts created since.
+var timelineAddScript = redis.NewScript(`
+local score = ARGV[1]
+local member = ARGV[2]
+local size = tonumber(ARGV[3])
+
+for _, key in ipairs(KEYS) do
+	if redis.call('EXISTS', key) == 1 then
+		redis.call('ZADD', key, score, member)
+		redis.call('ZREMRANGEBYRANK', key, 0, -(size + 1))
+	end
+end
+
+return 0
+`)
+
+// TimelineStore keeps the precomputed feed of each user as a sorted set of
+// post ids scored by their creation time in microseconds.
+type TimelineStore struct {
+	rdb  *redis.Client
+	size int
+	ttl  time.Duration
+}
+
+func timelineKey(userID int64) string {
+	return fmt.Sprintf("timeline-%v", userID)
+}
+
+// timelineMember pads the post id so that posts created the same
+// microsecond sort by id, the way the feed query orders them.
+func timelineMember(postID int64) string {
+	return fmt.Sprintf("%019d", postID)
+}
+
+func timelineScore(t time.Time) float64 {
+	return float64(t.UnixMicro())
+}
+
+// Get returns the page of the timeline of userID after cursor. ok is false
+// when the timeline cannot answer: it is not built, the cursor post left it,
+// or the page runs past its oldest post while older ones were trimmed.
+func (s *TimelineStore) Get(ctx context.Context, userID int64, cursor *store.Cursor, limit int) (entries []store.FeedEntry, ok bool, err error) {
+
+	key := timelineKey(userID)
+
+	var start int64
+	if cursor != nil {
+		rank, err := s.rdb.ZRevRank(ctx, key, timelineMember(cursor.ID)).Result()
+		if errors.Is(err, redis.Nil) {
+			return nil, false, nil
+		} else if err != nil {
+			return nil, false, err
+		}
+
+		start = rank + 1
+	}
+
+	pipe := s.rdb.Pipeline()
+	page := pipe.ZRevRangeWithScores(ctx, key, start, start+int64(limit)-1)
+	size := pipe.ZCard(ctx, key)
+	pipe.Expire(ctx, key, s.ttl)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, false, err
+	}
+
+	if size.Val() == 0 {
+		return nil, false, nil
+	}
+
+	if len(page.Val()) < limit && size.Val() >= int64(s.size) {
+		return nil, false, nil
+	}
+
+	entries = make([]store.FeedEntry, 0, len(page.Val()))
+	for _, z := range page.Val() {
+		id, err := strconv.ParseInt(z.Member.(string), 10, 64)
+		if err != nil {
+			return nil, false, err
+		}
+
+		entries = append(entries, store.FeedEntry{
+			ID:        id,
+			CreatedAt: time.UnixMicro(int64(z.Score)).UTC(),
+		})
+	}
+
+	return entries, true, nil
+}
+
+// Set replaces the timeline of userID with entries. An empty timeline is
+// not stored, its reads keep going to the database, which is cheap for it.
+func (s *TimelineStore) Set(ctx context.Context, userID int64, entries []store.FeedEntry) error {
+
+	key := timelineKey(userID)
+
+	members := make([]*redis.Z, 0, len(entries))
+	for _, e := range entries {
+		members = append(members, &redis.Z{Score: timelineScore(e.CreatedAt), Member: timelineMember(e.ID)})
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.Del(ctx, key)
+
+	if len(members) > 0 {
+		pipe.ZAdd(ctx, key, members...)
+		pipe.Expire(ctx, key, s.ttl)
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Add pushes a new post to the timelines of userIDs. The script is sent
+// whole rather than by its sha, a pipeline cannot recover from NOSCRIPT.
+func (s *TimelineStore) Add(ctx context.Context, userIDs []int64, entry store.FeedEntry) error {
+
+	pipe := s.rdb.Pipeline()
+
+	for i := 0; i < len(userIDs); i += fanoutBatch {
+		batch := userIDs[i:min(i+fanoutBatch, len(userIDs))]
+
+		keys := make([]string, 0, len(batch))
+		for _, id := range batch {
+			keys = append(keys, timelineKey(id))
+		}
+
+		timelineAddScript.Eval(ctx, pipe, keys, timelineScore(entry.CreatedAt), timelineMember(entry.ID), s.size)
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Remove takes a post out of the timelines of userIDs.
+func (s *TimelineStore) Remove(ctx context.Context, userIDs []int64, postID int64) error {
+
+	pipe := s.rdb.Pipeline()
+	for _, id := range userIDs {
+		pipe.ZRem(ctx, timelineKey(id), timelineMember(postID))
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Invalidate drops the timelines of userIDs, they are rebuilt on their next
+// read. It is how changes to who a user follows or mutes are picked up.
+func (s *TimelineStore) Invalidate(ctx context.Context, userIDs ...int64) error {
+
+	keys := make([]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		keys = append(keys, timelineKey(id))
+	}
+
+	return s.rdb.Del(ctx, keys...).Err()
+}
@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
 )
 
 type Comment struct {
@@ -11,6 +12,7 @@ type Comment struct {
 	UserID    int64  `json:"user_id"`
 	Content   string `json:"content"`
 	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
 	User      User   `json:"user"`
 }
 
@@ -18,19 +20,94 @@ type CommentStore struct {
 	db *sql.DB
 }
 
-func (s *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment, error) {
+func (s *CommentStore) Create(ctx context.Context, comment *Comment) error {
 
 	query := `
-		SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, users.email, users.id FROM comments c
+		INSERT INTO comments (post_id, user_id, content)
+		VALUES ($1, $2, $3) RETURNING id, created_at, updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		comment.PostID,
+		comment.UserID,
+		comment.Content,
+	).Scan(
+		&comment.ID,
+		&comment.CreatedAt,
+		&comment.UpdatedAt,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *CommentStore) GetByID(ctx context.Context, id int64) (*Comment, error) {
+
+	query := `
+		SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, c.updated_at, users.username, users.id FROM comments c
+		JOIN users ON users.id = c.user_id
+		WHERE c.id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var c Comment
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		id,
+	).Scan(
+		&c.ID,
+		&c.PostID,
+		&c.UserID,
+		&c.Content,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+		&c.User.Username,
+		&c.User.ID,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &c, nil
+}
+
+// GetByPostID lists the comments of a post as seen by viewerID, leaving out
+// the ones written by users the viewer muted or blocked, or who blocked them.
+func (s *CommentStore) GetByPostID(ctx context.Context, postID int64, viewerID int64) ([]Comment, error) {
+
+	query := `
+		SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, c.updated_at, users.username, users.id FROM comments c
 		JOIN users ON users.id = c.user_id
 		WHERE c.post_id = $1
+		  AND NOT EXISTS (SELECT 1 FROM user_mutes m WHERE m.muter_id = $2 AND m.muted_id = c.user_id)
+		  AND NOT EXISTS (
+		      SELECT 1 FROM user_blocks b
+		      WHERE (b.blocker_id = $2 AND b.blocked_id = c.user_id) OR (b.blocker_id = c.user_id AND b.blocked_id = $2)
+		  )
 		ORDER BY c.created_at DESC;
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, postID)
+	rows, err := s.db.QueryContext(ctx, query, postID, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -51,7 +128,8 @@ func (s *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment
 			&c.UserID,
 			&c.Content,
 			&c.CreatedAt,
-			&c.User.Email,
+			&c.UpdatedAt,
+			&c.User.Username,
 			&c.User.ID,
 		)
 		if err != nil {
@@ -63,3 +141,62 @@ func (s *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment
 
 	return comments, nil
 }
+
+func (s *CommentStore) Update(ctx context.Context, comment *Comment) error {
+
+	query := `
+		UPDATE comments
+		SET content = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		comment.Content,
+		comment.ID,
+	).Scan(
+		&comment.UpdatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *CommentStore) Delete(ctx context.Context, id int64) error {
+
+	query := `
+		DELETE FROM comments WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
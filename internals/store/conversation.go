@@ -0,0 +1,465 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrSelfMessage         = errors.New("user cannot message themselves")
+	ErrMessagingNotAllowed = errors.New("the user only accepts messages from their followers")
+)
+
+// Conversation is a direct conversation between two users, as seen by one
+// of them.
+type Conversation struct {
+	ID           int64                     `json:"id"`
+	Participants []ConversationParticipant `json:"participants"`
+	LastMessage  *Message                  `json:"last_message"`
+	UnreadCount  int64                     `json:"unread_count"`
+	CreatedAt    time.Time                 `json:"created_at"`
+	UpdatedAt    time.Time                 `json:"updated_at"`
+}
+
+// ConversationParticipant carries the read receipt of a user, the last
+// message they have seen.
+type ConversationParticipant struct {
+	PublicUser
+	LastReadMessageID *int64 `json:"last_read_message_id"`
+}
+
+type Message struct {
+	ID             int64     `json:"id"`
+	ConversationID int64     `json:"conversation_id"`
+	SenderID       int64     `json:"sender_id"`
+	Content        string    `json:"content"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type ConversationStore struct {
+	db *sql.DB
+}
+
+// conversationColumns selects a conversation as seen by the participant
+// joined as "me", with the last message joined as "lm".
+const conversationColumns = `
+	c.id, c.created_at, c.updated_at,
+	COALESCE((
+	    SELECT json_agg(p ORDER BY p.id)
+	    FROM (
+	        SELECT u.id, u.username, u.display_name, u.bio, u.avatar_url, u.is_private, u.created_at, cp.last_read_message_id
+	        FROM conversation_participants cp
+	        JOIN users u ON u.id = cp.user_id
+	        WHERE cp.conversation_id = c.id
+	    ) p
+	), '[]'::json),
+	(
+	    SELECT COUNT(*) FROM messages um
+	    WHERE um.conversation_id = c.id
+	      AND um.sender_id != me.user_id
+	      AND um.id > COALESCE(me.last_read_message_id, 0)
+	),
+	lm.id, lm.sender_id, lm.content, lm.created_at
+`
+
+const conversationFrom = `
+	FROM conversations c
+	JOIN conversation_participants me ON me.conversation_id = c.id
+	LEFT JOIN LATERAL (
+	    SELECT m.id, m.sender_id, m.content, m.created_at
+	    FROM messages m
+	    WHERE m.conversation_id = c.id
+	    ORDER BY m.id DESC
+	    LIMIT 1
+	) lm ON true
+`
+
+// GetOrCreateDirect returns the conversation between userID and
+// recipientID, starting it when they never talked before. created tells
+// which of the two happened.
+func (s *ConversationStore) GetOrCreateDirect(ctx context.Context, userID int64, recipientID int64) (conversation *Conversation, created bool, err error) {
+
+	if userID == recipientID {
+		return nil, false, ErrSelfMessage
+	}
+
+	directKey := fmt.Sprintf("%d:%d", min(userID, recipientID), max(userID, recipientID))
+
+	var conversationID int64
+
+	err = withTx(s.db, ctx, func(tx *sql.Tx) error {
+
+		if err := s.canMessage(ctx, tx, userID, recipientID); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO conversations (direct_key) VALUES ($1)
+			ON CONFLICT (direct_key) DO NOTHING
+			RETURNING id
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, query, directKey).Scan(&conversationID)
+		switch {
+		case err == nil:
+			created = true
+		case errors.Is(err, sql.ErrNoRows):
+			query = `SELECT id FROM conversations WHERE direct_key = $1`
+			if err := tx.QueryRowContext(ctx, query, directKey).Scan(&conversationID); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		query = `
+			INSERT INTO conversation_participants (conversation_id, user_id)
+			VALUES ($1, $2), ($1, $3)
+			ON CONFLICT (conversation_id, user_id) DO NOTHING
+		`
+
+		_, err = tx.ExecContext(ctx, query, conversationID, userID, recipientID)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	conversation, err = s.GetByID(ctx, conversationID, userID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return conversation, created, nil
+}
+
+// GetByID only finds conversations userID takes part in.
+func (s *ConversationStore) GetByID(ctx context.Context, conversationID int64, userID int64) (*Conversation, error) {
+
+	query := `SELECT ` + conversationColumns + conversationFrom + `
+		WHERE c.id = $1 AND me.user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	conversation, err := scanConversation(s.db.QueryRowContext(ctx, query, conversationID, userID))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return conversation, nil
+}
+
+// GetForUser lists the conversations of userID, the one with the latest
+// message first.
+func (s *ConversationStore) GetForUser(ctx context.Context, userID int64, cq PaginatedConversationQuery) ([]Conversation, error) {
+
+	query := `SELECT ` + conversationColumns + conversationFrom + `
+		WHERE me.user_id = $1
+		  AND ($3::timestamptz IS NULL OR (c.updated_at, c.id) < ($3, $4))
+		ORDER BY c.updated_at DESC, c.id DESC
+		LIMIT $2
+	`
+
+	cursorTime, cursorID := cursorArgs(cq.Cursor)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, cq.Limit, cursorTime, cursorID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	conversations := []Conversation{}
+	for rows.Next() {
+		conversation, err := scanConversation(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		conversations = append(conversations, *conversation)
+	}
+
+	return conversations, rows.Err()
+}
+
+// SendMessage checks again that the sender may still message every other
+// participant, a block or a change of settings applies to conversations
+// that already exist.
+func (s *ConversationStore) SendMessage(ctx context.Context, message *Message) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+
+		query := `
+			SELECT user_id FROM conversation_participants
+			WHERE conversation_id = $1 AND user_id != $2
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		rows, err := tx.QueryContext(ctx, query, message.ConversationID, message.SenderID)
+		if err != nil {
+			return err
+		}
+
+		var recipients []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				_ = rows.Close()
+				return err
+			}
+
+			recipients = append(recipients, id)
+		}
+
+		if err := rows.Close(); err != nil {
+			return err
+		}
+
+		for _, recipientID := range recipients {
+			if err := s.canMessage(ctx, tx, message.SenderID, recipientID); err != nil {
+				return err
+			}
+		}
+
+		query = `
+			INSERT INTO messages (conversation_id, sender_id, content)
+			VALUES ($1, $2, $3)
+			RETURNING id, created_at
+		`
+
+		err = tx.QueryRowContext(
+			ctx,
+			query,
+			message.ConversationID,
+			message.SenderID,
+			message.Content,
+		).Scan(
+			&message.ID,
+			&message.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		query = `UPDATE conversations SET updated_at = $2 WHERE id = $1`
+
+		if _, err := tx.ExecContext(ctx, query, message.ConversationID, message.CreatedAt); err != nil {
+			return err
+		}
+
+		// the sender has obviously seen their own message
+		return s.markRead(ctx, tx, message.ConversationID, message.SenderID, message.ID)
+	})
+}
+
+// GetMessages pages through the history of a conversation, newest first.
+func (s *ConversationStore) GetMessages(ctx context.Context, conversationID int64, cq PaginatedConversationQuery) ([]Message, error) {
+
+	query := `
+		SELECT id, conversation_id, sender_id, content, created_at
+		FROM messages
+		WHERE conversation_id = $1
+		  AND ($3::timestamptz IS NULL OR (created_at, id) < ($3, $4))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`
+
+	cursorTime, cursorID := cursorArgs(cq.Cursor)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, conversationID, cq.Limit, cursorTime, cursorID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		var m Message
+		err := rows.Scan(
+			&m.ID,
+			&m.ConversationID,
+			&m.SenderID,
+			&m.Content,
+			&m.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, m)
+	}
+
+	return messages, rows.Err()
+}
+
+// MarkRead moves the read receipt of userID up to messageID, or to the
+// latest message when messageID is zero, and returns where it ends up.
+// Receipts never move backwards.
+func (s *ConversationStore) MarkRead(ctx context.Context, conversationID int64, userID int64, messageID int64) (int64, error) {
+
+	var lastRead int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+
+		query := `
+			SELECT COALESCE(MAX(id), 0) FROM messages
+			WHERE conversation_id = $1 AND ($2 = 0 OR id <= $2)
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		var target int64
+		if err := tx.QueryRowContext(ctx, query, conversationID, messageID).Scan(&target); err != nil {
+			return err
+		}
+
+		if err := s.markRead(ctx, tx, conversationID, userID, target); err != nil {
+			return err
+		}
+
+		query = `
+			SELECT COALESCE(last_read_message_id, 0) FROM conversation_participants
+			WHERE conversation_id = $1 AND user_id = $2
+		`
+
+		return tx.QueryRowContext(ctx, query, conversationID, userID).Scan(&lastRead)
+	})
+
+	return lastRead, err
+}
+
+func (s *ConversationStore) markRead(ctx context.Context, tx *sql.Tx, conversationID int64, userID int64, messageID int64) error {
+
+	query := `
+		UPDATE conversation_participants
+		SET last_read_message_id = GREATEST(COALESCE(last_read_message_id, 0), $3)
+		WHERE conversation_id = $1 AND user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := tx.ExecContext(ctx, query, conversationID, userID, messageID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// canMessage fails when either user blocks the other, or when the
+// recipient only accepts messages from followers and the sender is not one.
+func (s *ConversationStore) canMessage(ctx context.Context, tx *sql.Tx, senderID int64, recipientID int64) error {
+
+	query := `
+		SELECT
+		    EXISTS (
+		        SELECT 1 FROM user_blocks
+		        WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+		    ),
+		    u.messages_followers_only
+		        AND NOT EXISTS (SELECT 1 FROM followers WHERE user_id = $2 AND follower_id = $1)
+		FROM users u
+		WHERE u.id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var blocked, followersOnly bool
+	err := tx.QueryRowContext(ctx, query, senderID, recipientID).Scan(&blocked, &followersOnly)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	if blocked {
+		return ErrBlocked
+	}
+
+	if followersOnly {
+		return ErrMessagingNotAllowed
+	}
+
+	return nil
+}
+
+func scanConversation(row interface{ Scan(...any) error }) (*Conversation, error) {
+
+	var c Conversation
+	var participants []byte
+	var lastID, lastSenderID *int64
+	var lastContent *string
+	var lastCreatedAt *time.Time
+
+	err := row.Scan(
+		&c.ID,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+		&participants,
+		&c.UnreadCount,
+		&lastID,
+		&lastSenderID,
+		&lastContent,
+		&lastCreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(participants, &c.Participants); err != nil {
+		return nil, err
+	}
+
+	if lastID != nil {
+		c.LastMessage = &Message{
+			ID:             *lastID,
+			ConversationID: c.ID,
+			SenderID:       *lastSenderID,
+			Content:        *lastContent,
+			CreatedAt:      *lastCreatedAt,
+		}
+	}
+
+	return &c, nil
+}
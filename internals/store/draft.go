@@ -0,0 +1,148 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+var (
+	ErrPublishAtRequired   = errors.New("a scheduled post needs a publish_at in the future")
+	ErrPublishAtNotAllowed = errors.New("publish_at is only for scheduled posts")
+	ErrAlreadyPublished    = errors.New("a published post cannot go back to draft or be scheduled")
+)
+
+// ResolvePostStatus checks the status a post is given along with when to
+// publish it. Without a status a post is published, or scheduled when it
+// comes with a publish_at.
+func ResolvePostStatus(status string, publishAt *time.Time, now time.Time) (string, *time.Time, error) {
+
+	if status == "" {
+		status = PostStatusPublished
+		if publishAt != nil {
+			status = PostStatusScheduled
+		}
+	}
+
+	switch status {
+	case PostStatusScheduled:
+		if publishAt == nil || !publishAt.After(now) {
+			return "", nil, ErrPublishAtRequired
+		}
+	default:
+		if publishAt != nil {
+			return "", nil, ErrPublishAtNotAllowed
+		}
+	}
+
+	return status, publishAt, nil
+}
+
+// GetDrafts lists the unpublished posts of userID, drafts and scheduled
+// posts alike unless dq.Status picks one, the most recently written first.
+func (s *PostStore) GetDrafts(ctx context.Context, userID int64, dq PaginatedDraftQuery) ([]Post, error) {
+
+	query := `
+		SELECT p.id, p.user_id, p.title, p.content, p.tags, p.status, p.publish_at, p.created_at, p.updated_at
+		FROM posts p
+		WHERE p.user_id = $1
+		  AND p.status != 'published'
+		  AND ($2 = '' OR p.status = $2)
+		  AND ($4::timestamptz IS NULL OR (p.created_at, p.id) < ($4, $5))
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $3
+	`
+
+	cursorTime, cursorID := cursorArgs(dq.Cursor)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, dq.Status, dq.Limit, cursorTime, cursorID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		var p Post
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			pq.Array(&p.Tags),
+			&p.Status,
+			&p.PublishAt,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, p)
+	}
+
+	return posts, rows.Err()
+}
+
+// PublishDue publishes up to limit scheduled posts whose time has come and
+// returns them. The due posts are claimed with SKIP LOCKED, so replicas
+// running the scheduler at the same time each publish a different batch
+// instead of waiting on one another or publishing a post twice.
+func (s *PostStore) PublishDue(ctx context.Context, limit int) ([]Post, error) {
+
+	query := `
+		WITH due AS (
+		    SELECT id FROM posts
+		    WHERE status = 'scheduled' AND publish_at <= NOW()
+		    ORDER BY publish_at, id
+		    LIMIT $1
+		    FOR UPDATE SKIP LOCKED
+		)
+		UPDATE posts p
+		SET status = 'published', created_at = NOW()
+		FROM due, users u
+		WHERE p.id = due.id AND u.id = p.user_id
+		RETURNING p.id, p.user_id, p.title, p.content, p.tags, p.status, p.publish_at, p.created_at, p.updated_at, u.id, u.username
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		var p Post
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			pq.Array(&p.Tags),
+			&p.Status,
+			&p.PublishAt,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			&p.User.ID,
+			&p.User.Username,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, p)
+	}
+
+	return posts, rows.Err()
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// rankingAffinityWindow is how far back the interactions of a viewer with
+// an author are counted.
+const rankingAffinityWindow = time.Hour * 24 * 30
+
+// FeedCandidate is a post that may be ranked into the feed of a viewer,
+// with the signals it is scored on.
+type FeedCandidate struct {
+	ID       int64
+	AuthorID int64
+	// SecondDegree is set when the viewer does not follow the author but
+	// some account they follow does.
+	SecondDegree bool
+	Comments     int64
+	// Interactions counts the comments and reactions of the viewer on the
+	// posts of the author over the last 30 days.
+	Interactions int64
+	CreatedAt    time.Time
+}
+
+// GetFeedCandidates lists the newest posts of the last window from the
+// viewer, the accounts they follow and the public accounts those follow.
+// The posts of the accounts the viewer follows and the second degree ones
+// are capped at limit each, a busy second degree network cannot crowd out
+// the accounts the viewer chose to follow before anything is scored.
+func (s *PostStore) GetFeedCandidates(ctx context.Context, viewerID int64, window time.Duration, limit int) ([]FeedCandidate, error) {
+
+	query := `
+		WITH following AS (
+		    SELECT f.user_id FROM followers f WHERE f.follower_id = $1
+		),
+		authors AS (
+		    SELECT $1::bigint AS id, false AS second_degree
+		    UNION ALL
+		    SELECT user_id, false FROM following
+		    UNION ALL
+		    SELECT DISTINCT f2.user_id, true
+		    FROM following fo
+		    JOIN followers f2 ON f2.follower_id = fo.user_id
+		    WHERE f2.user_id != $1 AND f2.user_id NOT IN (SELECT user_id FROM following)
+		),
+		visible AS (
+		    SELECT p.id, p.user_id, a.second_degree, p.created_at
+		    FROM authors a
+		    JOIN posts p ON p.user_id = a.id
+		    JOIN users u ON u.id = p.user_id
+		    WHERE p.status = 'published'
+		      AND p.created_at > NOW() - make_interval(secs => $2)
+		      AND (NOT a.second_degree OR NOT u.is_private)
+		      AND NOT EXISTS (SELECT 1 FROM user_mutes m WHERE m.muter_id = $1 AND m.muted_id = p.user_id)
+		      AND NOT EXISTS (
+		          SELECT 1 FROM user_blocks b
+		          WHERE (b.blocker_id = $1 AND b.blocked_id = p.user_id) OR (b.blocker_id = p.user_id AND b.blocked_id = $1)
+		      )
+		),
+		candidates AS (
+		    (SELECT * FROM visible WHERE NOT second_degree ORDER BY created_at DESC, id DESC LIMIT $3)
+		    UNION ALL
+		    (SELECT * FROM visible WHERE second_degree ORDER BY created_at DESC, id DESC LIMIT $3)
+		),
+		interactions AS (
+		    SELECT ip.user_id AS author_id, COUNT(*) AS total
+		    FROM (
+		        SELECT post_id FROM comments WHERE user_id = $1 AND created_at > NOW() - make_interval(secs => $4)
+		        UNION ALL
+		        SELECT post_id FROM reactions WHERE user_id = $1 AND created_at > NOW() - make_interval(secs => $4)
+		    ) i
+		    JOIN posts ip ON ip.id = i.post_id
+		    WHERE ip.user_id IN (SELECT user_id FROM candidates)
+		    GROUP BY ip.user_id
+		)
+		SELECT c.id, c.user_id, c.second_degree,
+		    (SELECT COUNT(*) FROM comments cm WHERE cm.post_id = c.id),
+		    COALESCE(ia.total, 0),
+		    c.created_at
+		FROM candidates c
+		LEFT JOIN interactions ia ON ia.author_id = c.user_id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, viewerID, window.Seconds(), limit, rankingAffinityWindow.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	candidates := []FeedCandidate{}
+	for rows.Next() {
+		var c FeedCandidate
+		err := rows.Scan(
+			&c.ID,
+			&c.AuthorID,
+			&c.SecondDegree,
+			&c.Comments,
+			&c.Interactions,
+			&c.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		candidates = append(candidates, c)
+	}
+
+	return candidates, rows.Err()
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// FollowRequest is a user waiting for a private account to approve their
+// follow.
+type FollowRequest struct {
+	PublicUser
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// GetFollowRequests lists the pending requests to follow userID, newest
+// first.
+func (s *FollowStore) GetFollowRequests(ctx context.Context, userID int64, fq PaginatedFollowQuery) ([]FollowRequest, error) {
+
+	query := `
+		SELECT u.id, u.username, u.display_name, u.bio, u.avatar_url, u.is_private, u.created_at, fr.created_at
+		FROM follow_requests fr
+		JOIN users u ON u.id = fr.requester_id
+		WHERE fr.user_id = $1
+		  AND ($3::timestamptz IS NULL OR (fr.created_at, u.id) < ($3, $4))
+		ORDER BY fr.created_at DESC, u.id DESC
+		LIMIT $2
+	`
+
+	cursorTime, cursorID := cursorArgs(fq.Cursor)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, cursorTime, cursorID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	requests := []FollowRequest{}
+	for rows.Next() {
+		var fr FollowRequest
+		err := rows.Scan(
+			&fr.ID,
+			&fr.Username,
+			&fr.DisplayName,
+			&fr.Bio,
+			&fr.AvatarURL,
+			&fr.IsPrivate,
+			&fr.CreatedAt,
+			&fr.RequestedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		requests = append(requests, fr)
+	}
+
+	return requests, rows.Err()
+}
+
+// ApproveFollowRequest turns the pending request of requesterID into a
+// follow of userID.
+func (s *FollowStore) ApproveFollowRequest(ctx context.Context, userID int64, requesterID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+
+		if err := s.deleteFollowRequest(ctx, tx, userID, requesterID); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO followers (user_id, follower_id) VALUES ($1, $2)
+			ON CONFLICT (user_id, follower_id) DO NOTHING
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
+
+		_, err := tx.ExecContext(ctx, query, userID, requesterID)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (s *FollowStore) RejectFollowRequest(ctx context.Context, userID int64, requesterID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.deleteFollowRequest(ctx, tx, userID, requesterID)
+	})
+}
+
+func (s *FollowStore) deleteFollowRequest(ctx context.Context, tx *sql.Tx, userID int64, requesterID int64) error {
+
+	query := `DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := tx.ExecContext(ctx, query, userID, requesterID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"github.com/lib/pq"
+	"time"
 )
 
 type Follow struct {
@@ -13,39 +14,109 @@ type Follow struct {
 	CreatedAt  string `json:"created_at"`
 }
 
+// FollowListEntry is a user in a followers or following list, with the time
+// the follow happened since lists are ordered by it.
+type FollowListEntry struct {
+	PublicUser
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+// Relationship is how the viewer and another user are connected.
+type Relationship struct {
+	Following  bool `json:"you_follow"`
+	FollowedBy bool `json:"follows_you"`
+	Requested  bool `json:"follow_requested"`
+}
+
 type FollowStore struct {
 	db *sql.DB
 }
 
-func (s *FollowStore) Follow(ctx context.Context, userID int64, toBeFollowedID int64) error {
-
-	query := `INSERT INTO followers(user_id, follower_id) VALUES ($1, $2)`
+// Follow makes userID a follower of toBeFollowedID. When the account is
+// private a follow request is left instead and requested is true, the
+// follow only happens once the request is approved.
+func (s *FollowStore) Follow(ctx context.Context, userID int64, toBeFollowedID int64) (requested bool, err error) {
+	err = withTx(s.db, ctx, func(tx *sql.Tx) error {
 
-	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
-	defer cancel()
+		query := `
+			SELECT
+			    u.is_private,
+			    EXISTS (
+			        SELECT 1 FROM user_blocks
+			        WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+			    ),
+			    EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2)
+			FROM users u
+			WHERE u.id = $1
+		`
 
-	_, err := s.db.ExecContext(ctx, query, toBeFollowedID, userID)
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		defer cancel()
 
-	if err != nil {
-		var pqErr *pq.Error
-		if errors.As(err, &pqErr) {
-			if pqErr.Code == "23514" && pqErr.Constraint == "chk_user_not_self_follow" {
-				return ErrSelfFollow
+		var isPrivate, blocked, following bool
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			toBeFollowedID,
+			userID,
+		).Scan(
+			&isPrivate,
+			&blocked,
+			&following,
+		)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
 			}
-			if pqErr.Code == "23505" && pqErr.Constraint == "followers_pkey" {
-				return ErrDuplicateFollow
+		}
+
+		if blocked {
+			return ErrBlocked
+		}
+
+		if isPrivate && !following {
+			requested = true
+			query = `
+				INSERT INTO follow_requests (user_id, requester_id) VALUES ($1, $2)
+				ON CONFLICT (user_id, requester_id) DO NOTHING
+			`
+		} else {
+			query = `INSERT INTO followers (user_id, follower_id) VALUES ($1, $2)`
+		}
+
+		_, err = tx.ExecContext(ctx, query, toBeFollowedID, userID)
+		if err != nil {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) {
+				if pqErr.Code == "23514" && (pqErr.Constraint == "chk_user_not_self_follow" || pqErr.Constraint == "chk_user_not_self_follow_request") {
+					return ErrSelfFollow
+				}
+				if pqErr.Code == "23505" && pqErr.Constraint == "followers_pkey" {
+					return ErrDuplicateFollow
+				}
 			}
+
+			return err
 		}
 
-		return err
-	}
+		return nil
+	})
 
-	return nil
+	return requested, err
 }
 
+// Unfollow also withdraws a pending follow request.
 func (s *FollowStore) Unfollow(ctx context.Context, userID int64, toBeUnfollowedID int64) error {
 
-	query := `DELETE FROM followers WHERE user_id = $1 AND follower_id = $2`
+	query := `
+		WITH request AS (
+		    DELETE FROM follow_requests WHERE user_id = $1 AND requester_id = $2
+		)
+		DELETE FROM followers WHERE user_id = $1 AND follower_id = $2
+	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
@@ -58,3 +129,165 @@ func (s *FollowStore) Unfollow(ctx context.Context, userID int64, toBeUnfollowed
 
 	return nil
 }
+
+// GetFollowers lists the users following userID, newest follow first.
+func (s *FollowStore) GetFollowers(ctx context.Context, userID int64, fq PaginatedFollowQuery) ([]FollowListEntry, error) {
+
+	query := `
+		SELECT u.id, u.username, u.display_name, u.bio, u.avatar_url, u.created_at, f.created_at
+		FROM followers f
+		JOIN users u ON u.id = f.follower_id
+		WHERE f.user_id = $1
+		  AND ($3::timestamptz IS NULL OR (f.created_at, u.id) < ($3, $4))
+		ORDER BY f.created_at DESC, u.id DESC
+		LIMIT $2
+	`
+
+	return s.list(ctx, query, userID, fq)
+}
+
+// GetFollowing lists the users userID follows, newest follow first.
+func (s *FollowStore) GetFollowing(ctx context.Context, userID int64, fq PaginatedFollowQuery) ([]FollowListEntry, error) {
+
+	query := `
+		SELECT u.id, u.username, u.display_name, u.bio, u.avatar_url, u.created_at, f.created_at
+		FROM followers f
+		JOIN users u ON u.id = f.user_id
+		WHERE f.follower_id = $1
+		  AND ($3::timestamptz IS NULL OR (f.created_at, u.id) < ($3, $4))
+		ORDER BY f.created_at DESC, u.id DESC
+		LIMIT $2
+	`
+
+	return s.list(ctx, query, userID, fq)
+}
+
+func (s *FollowStore) list(ctx context.Context, query string, userID int64, fq PaginatedFollowQuery) ([]FollowListEntry, error) {
+
+	cursorTime, cursorID := cursorArgs(fq.Cursor)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, cursorTime, cursorID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	users := []FollowListEntry{}
+	for rows.Next() {
+		var u FollowListEntry
+		err := rows.Scan(
+			&u.ID,
+			&u.Username,
+			&u.DisplayName,
+			&u.Bio,
+			&u.AvatarURL,
+			&u.CreatedAt,
+			&u.FollowedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+func (s *FollowStore) GetRelationship(ctx context.Context, viewerID int64, userID int64) (*Relationship, error) {
+
+	query := `
+		SELECT
+		    EXISTS (SELECT 1 FROM followers WHERE user_id = $2 AND follower_id = $1),
+		    EXISTS (SELECT 1 FROM followers WHERE user_id = $1 AND follower_id = $2),
+		    EXISTS (SELECT 1 FROM follow_requests WHERE user_id = $2 AND requester_id = $1)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	relationship := &Relationship{}
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		viewerID,
+		userID,
+	).Scan(
+		&relationship.Following,
+		&relationship.FollowedBy,
+		&relationship.Requested,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return relationship, nil
+}
+
+// CanSeePosts reports whether viewerID may see the posts of userID, which
+// is always the case unless userID is private and not followed by the viewer.
+func (s *FollowStore) CanSeePosts(ctx context.Context, viewerID int64, userID int64) (bool, error) {
+
+	query := `
+		SELECT NOT u.is_private
+		    OR u.id = $1
+		    OR EXISTS (SELECT 1 FROM followers WHERE user_id = u.id AND follower_id = $1)
+		FROM users u
+		WHERE u.id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var allowed bool
+	err := s.db.QueryRowContext(ctx, query, viewerID, userID).Scan(&allowed)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, ErrNotFound
+		default:
+			return false, err
+		}
+	}
+
+	return allowed, nil
+}
+
+// GetFeedAuthorIDs returns the users whose posts make it into the feed of
+// userID: the ones it follows and has not muted, and itself.
+func (s *FollowStore) GetFeedAuthorIDs(ctx context.Context, userID int64) ([]int64, error) {
+
+	query := `
+		SELECT $1::bigint
+		UNION
+		SELECT f.user_id FROM followers f
+		WHERE f.follower_id = $1
+		  AND NOT EXISTS (SELECT 1 FROM user_mutes m WHERE m.muter_id = $1 AND m.muted_id = f.user_id)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
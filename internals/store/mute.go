@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrSelfMute = errors.New("user cannot mute themselves")
+)
+
+// MuteStore keeps the users whose posts and comments are hidden from the
+// muting user. Unlike a block, the muted user is not told and can still
+// follow and interact.
+type MuteStore struct {
+	db *sql.DB
+}
+
+func (s *MuteStore) Mute(ctx context.Context, userID int64, toBeMutedID int64) error {
+
+	query := `
+		INSERT INTO user_mutes (muter_id, muted_id) VALUES ($1, $2)
+		ON CONFLICT (muter_id, muted_id) DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, toBeMutedID)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) {
+			if pqErr.Code == "23514" && pqErr.Constraint == "chk_user_not_self_mute" {
+				return ErrSelfMute
+			}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (s *MuteStore) Unmute(ctx context.Context, userID int64, toBeUnmutedID int64) error {
+
+	query := `DELETE FROM user_mutes WHERE muter_id = $1 AND muted_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, toBeUnmutedID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,291 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"regexp"
+	"time"
+)
+
+// Notification kinds, kept in sync with the chk_notification_kind constraint.
+const (
+	NotificationFollow        = "follow"
+	NotificationFollowRequest = "follow_request"
+	NotificationComment       = "comment"
+	NotificationMention       = "mention"
+	NotificationReaction      = "reaction"
+)
+
+// notificationVerbs complete the sentence started by the actors of a
+// notification group.
+var notificationVerbs = map[string]string{
+	NotificationFollow:        "started following you",
+	NotificationFollowRequest: "requested to follow you",
+	NotificationComment:       "commented on your post",
+	NotificationMention:       "mentioned you",
+	NotificationReaction:      "reacted to your post",
+}
+
+// notificationActorsShown is how many actors of a group are returned, the
+// rest are only counted.
+const notificationActorsShown = 3
+
+var mentionRegex = regexp.MustCompile(`(?:^|[^A-Za-z0-9_])@([A-Za-z0-9_]{3,30})\b`)
+
+// Notification is a single event addressed to UserID. PostID and CommentID
+// are set depending on the kind.
+type Notification struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	ActorID   int64     `json:"actor_id"`
+	Kind      string    `json:"kind"`
+	PostID    *int64    `json:"post_id"`
+	CommentID *int64    `json:"comment_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NotificationGroup is what a user is shown: the notifications of the same
+// kind about the same post, or the same kind altogether for follows, folded
+// into one entry such as "alice and 4 others reacted to your post". Read
+// and unread notifications are never folded together.
+type NotificationGroup struct {
+	ID          int64        `json:"id"`
+	Kind        string       `json:"kind"`
+	PostID      *int64       `json:"post_id"`
+	Unread      bool         `json:"unread"`
+	Actors      []PublicUser `json:"actors"`
+	ActorsCount int64        `json:"actors_count"`
+	Message     string       `json:"message"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+type NotificationStore struct {
+	db *sql.DB
+}
+
+// Create is a no-op when the actor is the recipient, when either of them
+// blocks the other or when the recipient muted the actor.
+func (s *NotificationStore) Create(ctx context.Context, n *Notification) error {
+
+	query := `
+		INSERT INTO notifications (user_id, actor_id, kind, post_id, comment_id)
+		SELECT $1::bigint, $2::bigint, $3, $4::bigint, $5::bigint
+		WHERE $1::bigint != $2::bigint AND ` + notifiable("$1", "$2") + `
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, n.UserID, n.ActorID, n.Kind, n.PostID, n.CommentID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CreateMentions notifies every existing user mentioned as @username in
+// text, under the same conditions as Create. Users who cannot see the post
+// of a private author are not told about it, the same rule as CanSeePosts.
+func (s *NotificationStore) CreateMentions(ctx context.Context, n *Notification, text string) error {
+
+	var usernames []string
+	for _, match := range mentionRegex.FindAllStringSubmatch(text, -1) {
+		usernames = append(usernames, match[1])
+	}
+
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO notifications (user_id, actor_id, kind, post_id, comment_id)
+		SELECT u.id, $1::bigint, $2, $3::bigint, $4::bigint
+		FROM users u
+		WHERE u.username = ANY($5::citext[])
+		  AND u.id != $1
+		  AND ` + notifiable("u.id", "$1") + `
+		  AND ($3::bigint IS NULL OR EXISTS (
+		      SELECT 1 FROM posts p
+		      JOIN users a ON a.id = p.user_id
+		      WHERE p.id = $3
+		        AND (
+		            NOT a.is_private
+		            OR a.id = u.id
+		            OR EXISTS (SELECT 1 FROM followers f WHERE f.user_id = a.id AND f.follower_id = u.id)
+		        )
+		  ))
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, n.ActorID, NotificationMention, n.PostID, n.CommentID, pq.Array(usernames))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetGroups lists the notification groups of userID, the most recently
+// active first.
+func (s *NotificationStore) GetGroups(ctx context.Context, userID int64, nq PaginatedNotificationQuery) ([]NotificationGroup, error) {
+
+	query := `
+		WITH groups AS (
+		    SELECT n.kind, n.post_id, n.read_at IS NULL AS unread,
+		        MAX(n.id) AS id, MAX(n.created_at) AS latest, COUNT(DISTINCT n.actor_id) AS actors_count
+		    FROM notifications n
+		    WHERE n.user_id = $1 AND (NOT $2 OR n.read_at IS NULL)
+		    GROUP BY n.kind, n.post_id, n.read_at IS NULL
+		)
+		SELECT g.id, g.kind, g.post_id, g.unread, g.actors_count, g.latest,
+		    COALESCE((
+		        SELECT json_agg(a)
+		        FROM (
+		            SELECT u.id, u.username, u.display_name, u.bio, u.avatar_url, u.is_private, u.created_at
+		            FROM notifications an
+		            JOIN users u ON u.id = an.actor_id
+		            WHERE an.user_id = $1
+		              AND an.kind = g.kind
+		              AND an.post_id IS NOT DISTINCT FROM g.post_id
+		              AND (an.read_at IS NULL) = g.unread
+		            GROUP BY u.id
+		            ORDER BY MAX(an.created_at) DESC, u.id DESC
+		            LIMIT $6
+		        ) a
+		    ), '[]'::json)
+		FROM groups g
+		WHERE ($4::timestamptz IS NULL OR (g.latest, g.id) < ($4, $5))
+		ORDER BY g.latest DESC, g.id DESC
+		LIMIT $3
+	`
+
+	cursorTime, cursorID := cursorArgs(nq.Cursor)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, nq.UnreadOnly, nq.Limit, cursorTime, cursorID, notificationActorsShown)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	groups := []NotificationGroup{}
+	for rows.Next() {
+		var g NotificationGroup
+		var actors []byte
+		err := rows.Scan(
+			&g.ID,
+			&g.Kind,
+			&g.PostID,
+			&g.Unread,
+			&g.ActorsCount,
+			&g.CreatedAt,
+			&actors,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(actors, &g.Actors); err != nil {
+			return nil, err
+		}
+
+		g.Message = g.describe()
+		groups = append(groups, g)
+	}
+
+	return groups, rows.Err()
+}
+
+func (s *NotificationStore) CountUnread(ctx context.Context, userID int64) (int64, error) {
+
+	query := `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var count int64
+	if err := s.db.QueryRowContext(ctx, query, userID).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// MarkRead marks the unread notifications of userID as read, only the
+// ones in the groups given by their ids when there are any.
+func (s *NotificationStore) MarkRead(ctx context.Context, userID int64, groupIDs []int64) (int64, error) {
+
+	query := `
+		UPDATE notifications n
+		SET read_at = NOW()
+		WHERE n.user_id = $1
+		  AND n.read_at IS NULL
+		  AND (cardinality($2::bigint[]) = 0 OR EXISTS (
+		      SELECT 1 FROM notifications g
+		      WHERE g.id = ANY($2)
+		        AND g.user_id = n.user_id
+		        AND g.kind = n.kind
+		        AND g.post_id IS NOT DISTINCT FROM n.post_id
+		  ))
+	`
+
+	if groupIDs == nil {
+		groupIDs = []int64{}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, pq.Array(groupIDs))
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (g *NotificationGroup) describe() string {
+
+	verb := notificationVerbs[g.Kind]
+
+	if len(g.Actors) == 0 {
+		return verb
+	}
+
+	first := g.Actors[0].Username
+
+	switch {
+	case g.ActorsCount == 1:
+		return fmt.Sprintf("%s %s", first, verb)
+	case g.ActorsCount == 2 && len(g.Actors) > 1:
+		return fmt.Sprintf("%s and %s %s", first, g.Actors[1].Username, verb)
+	case g.ActorsCount == 2:
+		return fmt.Sprintf("%s and 1 other %s", first, verb)
+	default:
+		return fmt.Sprintf("%s and %d others %s", first, g.ActorsCount-1, verb)
+	}
+}
+
+// notifiable is the sql condition under which the actor may notify the
+// recipient, both given as sql expressions.
+func notifiable(recipientID, actorID string) string {
+	return `NOT EXISTS (
+		    SELECT 1 FROM user_blocks b
+		    WHERE (b.blocker_id = ` + recipientID + ` AND b.blocked_id = ` + actorID + `)
+		       OR (b.blocker_id = ` + actorID + ` AND b.blocked_id = ` + recipientID + `)
+		)
+		AND NOT EXISTS (
+		    SELECT 1 FROM user_mutes m WHERE m.muter_id = ` + recipientID + ` AND m.muted_id = ` + actorID + `
+		)`
+}
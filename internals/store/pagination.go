@@ -1,17 +1,89 @@
 package store
 
 import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
+var (
+	ErrInvalidCursor     = errors.New("invalid cursor")
+	ErrInvalidFeedWindow = errors.New("since must be before until")
+	ErrRankedFeedCursor  = errors.New("the ranked feed is paged with offset, not cursor")
+)
+
+// Feed modes, the chronological feed is ordered by Sort while the ranked
+// one is ordered by score.
+const (
+	FeedModeChronological = "chronological"
+	FeedModeRanked        = "ranked"
+)
+
+// PaginatedFeedQuery filters the feed. Since is inclusive and Until is
+// exclusive, Authors narrows the feed down to some of the followed accounts.
 type PaginatedFeedQuery struct {
-	Limit  int      `json:"limit" validate:"gte=1,lte=20"`
-	Offset int      `json:"offset" validate:"gte=0"`
-	Sort   string   `json:"sort" validate:"oneof=asc desc"`
-	Tags   []string `json:"tags" validate:"max=5"`
-	Search string   `json:"search" validate:"max=1000"`
+	Limit   int        `json:"limit" validate:"gte=1,lte=20"`
+	Offset  int        `json:"offset" validate:"gte=0"`
+	Sort    string     `json:"sort" validate:"oneof=asc desc"`
+	Mode    string     `json:"mode" validate:"oneof=chronological ranked"`
+	Tags    []string   `json:"tags" validate:"max=5"`
+	Authors []int64    `json:"authors" validate:"max=20,dive,gt=0"`
+	Since   *time.Time `json:"since"`
+	Until   *time.Time `json:"until"`
+	Search  string     `json:"search" validate:"max=1000"`
+	Cursor  *Cursor    `json:"cursor"`
+}
+
+// Cursor is the keyset position of the last item a client has seen. Lists
+// are ordered by (created_at, id) so the pair is unique and stable while new
+// items keep arriving.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+// Encode returns the opaque form of the cursor handed out to clients.
+func (c Cursor) Encode() string {
+	raw := fmt.Sprintf("%s|%d", c.CreatedAt.UTC().Format(time.RFC3339Nano), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// After tells whether c comes after o in (created_at, id) order.
+func (c Cursor) After(o Cursor) bool {
+	if !c.CreatedAt.Equal(o.CreatedAt) {
+		return c.CreatedAt.After(o.CreatedAt)
+	}
+
+	return c.ID > o.ID
+}
+
+func DecodeCursor(encoded string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	createdAt, id, found := strings.Cut(string(raw), "|")
+	if !found {
+		return nil, ErrInvalidCursor
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &Cursor{CreatedAt: t, ID: i}, nil
 }
 
 func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error) {
@@ -21,8 +93,13 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 	limit := qs.Get("limit")
 	offset := qs.Get("offset")
 	sort := qs.Get("sort")
+	mode := qs.Get("mode")
 	tags := qs.Get("tags")
+	authors := qs.Get("authors")
+	since := qs.Get("since")
+	until := qs.Get("until")
 	search := qs.Get("search")
+	cursor := qs.Get("cursor")
 
 	if limit != "" {
 		l, err := strconv.Atoi(limit)
@@ -46,13 +123,343 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 		fq.Sort = sort
 	}
 
+	if mode != "" {
+		fq.Mode = mode
+	}
+
 	if tags != "" {
-		fq.Tags = strings.Split(tags, ",")
+		t, err := NormalizeTags(strings.Split(tags, ","))
+		if err != nil {
+			return fq, err
+		}
+
+		fq.Tags = t
+	}
+
+	if authors != "" {
+		for _, a := range strings.Split(authors, ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(a), 10, 64)
+			if err != nil {
+				return fq, err
+			}
+
+			fq.Authors = append(fq.Authors, id)
+		}
+	}
+
+	if since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return fq, err
+		}
+
+		fq.Since = &t
+	}
+
+	if until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return fq, err
+		}
+
+		fq.Until = &t
+	}
+
+	if fq.Since != nil && fq.Until != nil && !fq.Since.Before(*fq.Until) {
+		return fq, ErrInvalidFeedWindow
 	}
 
 	if search != "" {
 		fq.Search = search
 	}
 
+	if cursor != "" {
+		if fq.Mode == FeedModeRanked {
+			return fq, ErrRankedFeedCursor
+		}
+
+		c, err := DecodeCursor(cursor)
+		if err != nil {
+			return fq, err
+		}
+
+		// the cursor already marks the position, so an offset would skip posts
+		fq.Cursor = c
+		fq.Offset = 0
+	}
+
 	return fq, nil
 }
+
+// Filtered tells whether the query narrows the feed down rather than
+// listing all of it.
+func (fq PaginatedFeedQuery) Filtered() bool {
+	return fq.Search != "" ||
+		len(fq.Tags) > 0 ||
+		len(fq.Authors) > 0 ||
+		fq.Since != nil ||
+		fq.Until != nil
+}
+
+type PaginatedFollowQuery struct {
+	Limit  int     `json:"limit" validate:"gte=1,lte=50"`
+	Cursor *Cursor `json:"cursor"`
+}
+
+func (fq PaginatedFollowQuery) Parse(r *http.Request) (PaginatedFollowQuery, error) {
+
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	cursor := qs.Get("cursor")
+
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return fq, err
+		}
+
+		fq.Limit = l
+	}
+
+	if cursor != "" {
+		c, err := DecodeCursor(cursor)
+		if err != nil {
+			return fq, err
+		}
+
+		fq.Cursor = c
+	}
+
+	return fq, nil
+}
+
+// cursorArgs turns an optional cursor into query arguments, a NULL time
+// disables the keyset predicate so the first page starts from the top.
+func cursorArgs(c *Cursor) (sql.NullTime, int64) {
+	if c == nil {
+		return sql.NullTime{}, 0
+	}
+
+	return sql.NullTime{Time: c.CreatedAt, Valid: true}, c.ID
+}
+
+type PaginatedNotificationQuery struct {
+	Limit      int     `json:"limit" validate:"gte=1,lte=50"`
+	UnreadOnly bool    `json:"unread"`
+	Cursor     *Cursor `json:"cursor"`
+}
+
+func (nq PaginatedNotificationQuery) Parse(r *http.Request) (PaginatedNotificationQuery, error) {
+
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	unread := qs.Get("unread")
+	cursor := qs.Get("cursor")
+
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return nq, err
+		}
+
+		nq.Limit = l
+	}
+
+	if unread != "" {
+		u, err := strconv.ParseBool(unread)
+		if err != nil {
+			return nq, err
+		}
+
+		nq.UnreadOnly = u
+	}
+
+	if cursor != "" {
+		c, err := DecodeCursor(cursor)
+		if err != nil {
+			return nq, err
+		}
+
+		nq.Cursor = c
+	}
+
+	return nq, nil
+}
+
+// PaginatedConversationQuery pages both the conversations of a user and the
+// messages of a conversation.
+type PaginatedConversationQuery struct {
+	Limit  int     `json:"limit" validate:"gte=1,lte=100"`
+	Cursor *Cursor `json:"cursor"`
+}
+
+func (cq PaginatedConversationQuery) Parse(r *http.Request) (PaginatedConversationQuery, error) {
+
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	cursor := qs.Get("cursor")
+
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return cq, err
+		}
+
+		cq.Limit = l
+	}
+
+	if cursor != "" {
+		c, err := DecodeCursor(cursor)
+		if err != nil {
+			return cq, err
+		}
+
+		cq.Cursor = c
+	}
+
+	return cq, nil
+}
+
+type PaginatedSearchQuery struct {
+	Query  string `json:"q" validate:"required,max=200"`
+	Limit  int    `json:"limit" validate:"gte=1,lte=50"`
+	Offset int    `json:"offset" validate:"gte=0"`
+}
+
+func (sq PaginatedSearchQuery) Parse(r *http.Request) (PaginatedSearchQuery, error) {
+
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	offset := qs.Get("offset")
+
+	sq.Query = strings.TrimSpace(qs.Get("q"))
+
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return sq, err
+		}
+
+		sq.Limit = l
+	}
+
+	if offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return sq, err
+		}
+
+		sq.Offset = o
+	}
+
+	return sq, nil
+}
+
+type PaginatedTagQuery struct {
+	Limit  int     `json:"limit" validate:"gte=1,lte=50"`
+	Cursor *Cursor `json:"cursor"`
+}
+
+func (tq PaginatedTagQuery) Parse(r *http.Request) (PaginatedTagQuery, error) {
+
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	cursor := qs.Get("cursor")
+
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return tq, err
+		}
+
+		tq.Limit = l
+	}
+
+	if cursor != "" {
+		c, err := DecodeCursor(cursor)
+		if err != nil {
+			return tq, err
+		}
+
+		tq.Cursor = c
+	}
+
+	return tq, nil
+}
+
+type PaginatedDraftQuery struct {
+	Limit  int     `json:"limit" validate:"gte=1,lte=50"`
+	Status string  `json:"status" validate:"omitempty,oneof=draft scheduled"`
+	Cursor *Cursor `json:"cursor"`
+}
+
+func (dq PaginatedDraftQuery) Parse(r *http.Request) (PaginatedDraftQuery, error) {
+
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	status := qs.Get("status")
+	cursor := qs.Get("cursor")
+
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return dq, err
+		}
+
+		dq.Limit = l
+	}
+
+	if status != "" {
+		dq.Status = status
+	}
+
+	if cursor != "" {
+		c, err := DecodeCursor(cursor)
+		if err != nil {
+			return dq, err
+		}
+
+		dq.Cursor = c
+	}
+
+	return dq, nil
+}
+
+type PaginatedRevisionQuery struct {
+	Limit  int     `json:"limit" validate:"gte=1,lte=50"`
+	Cursor *Cursor `json:"cursor"`
+}
+
+func (rq PaginatedRevisionQuery) Parse(r *http.Request) (PaginatedRevisionQuery, error) {
+
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	cursor := qs.Get("cursor")
+
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return rq, err
+		}
+
+		rq.Limit = l
+	}
+
+	if cursor != "" {
+		c, err := DecodeCursor(cursor)
+		if err != nil {
+			return rq, err
+		}
+
+		rq.Cursor = c
+	}
+
+	return rq, nil
+}
@@ -4,21 +4,35 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
 	"github.com/lib/pq"
 	"time"
 )
 
+// Post statuses, kept in sync with the chk_post_status constraint. Only
+// published posts are listed anywhere but in the drafts of their author.
+const (
+	PostStatusDraft     = "draft"
+	PostStatusScheduled = "scheduled"
+	PostStatusPublished = "published"
+)
+
+// Post is a post of a user. The CreatedAt of a post published after being
+// drafted or scheduled is when it was published, so it lands at the top of
+// the feeds rather than among the posts of the day it was written.
 type Post struct {
-	ID        int64     `json:"id"`
-	Title     string    `json:"title"`
-	Content   string    `json:"content"`
-	UserID    int64     `json:"user_id"`
-	Tags      []string  `json:"tags"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Comments  []Comment `json:"comments"`
-	User      User      `json:"user"`
+	ID        int64           `json:"id"`
+	Title     string          `json:"title"`
+	Content   string          `json:"content"`
+	UserID    int64           `json:"user_id"`
+	Tags      []string        `json:"tags"`
+	Status    string          `json:"status"`
+	PublishAt *time.Time      `json:"publish_at"`
+	EditedAt  *time.Time      `json:"edited_at"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	Comments  []Comment       `json:"comments"`
+	User      User            `json:"user"`
+	Reactions ReactionSummary `json:"reactions"`
 }
 
 type PostWithMetaData struct {
@@ -32,8 +46,8 @@ type PostStore struct {
 
 func (s *PostStore) Create(ctx context.Context, post *Post) error {
 	query := `
-		INSERT INTO posts (content, title, user_id, tags)
-		VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at
+		INSERT INTO posts (content, title, user_id, tags, status, publish_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at, updated_at
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
@@ -45,6 +59,8 @@ func (s *PostStore) Create(ctx context.Context, post *Post) error {
 		post.Title,
 		post.UserID,
 		pq.Array(post.Tags),
+		post.Status,
+		post.PublishAt,
 	).Scan(
 		&post.ID,
 		&post.CreatedAt,
@@ -60,7 +76,7 @@ func (s *PostStore) Create(ctx context.Context, post *Post) error {
 
 func (s *PostStore) GetPostByID(ctx context.Context, id int64) (*Post, error) {
 	query := `
-		SELECT id, title, user_id, content, tags, created_at, updated_at
+		SELECT id, title, user_id, content, tags, status, publish_at, edited_at, created_at, updated_at
 		FROM posts 
 		WHERE id = $1
 	`
@@ -78,6 +94,9 @@ func (s *PostStore) GetPostByID(ctx context.Context, id int64) (*Post, error) {
 		&post.UserID,
 		&post.Content,
 		pq.Array(&post.Tags),
+		&post.Status,
+		&post.PublishAt,
+		&post.EditedAt,
 		&post.CreatedAt,
 		&post.UpdatedAt,
 	)
@@ -94,20 +113,21 @@ func (s *PostStore) GetPostByID(ctx context.Context, id int64) (*Post, error) {
 	return &post, nil
 }
 
-func (s *PostStore) Update(ctx context.Context, post *Post) error {
+// Update saves the title, content and status of the post, keeping what it
+// replaced as a revision by editorID. A post going from unpublished to
+// published gets the current time as its CreatedAt, and published is true.
+// An empty Status keeps the post's current status.
+func (s *PostStore) Update(ctx context.Context, post *Post, editorID int64) (published bool, err error) {
 
-	query := `
-		UPDATE posts 
-		SET title = $1, content = $2
-		WHERE id = $3
-	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
 
-	_, err := s.db.ExecContext(ctx, query, post.Title, post.Content, post.ID)
-	if err != nil {
+	err = withTx(s.db, ctx, func(tx *sql.Tx) error {
+		published, err = updatePost(ctx, tx, post, editorID)
 		return err
-	}
+	})
 
-	return nil
+	return published, err
 }
 
 func (s *PostStore) Delete(ctx context.Context, id int64) error {
@@ -137,58 +157,110 @@ func (s *PostStore) Delete(ctx context.Context, id int64) error {
 
 func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetaData, error) {
 
-	fmt.Println(fq.Search)
+	keysetOperator := "<"
+	if fq.Sort == "asc" {
+		keysetOperator = ">"
+	}
 
+	// the feed is the posts of the user and of the accounts they follow,
+	// following a private account means the request was approved
 	query := `
-		SELECT p.id, p.user_id, p.title, p.content, p.tags, p.created_at, p.updated_at, u.id, u.email,
-       		COUNT(c.id) AS comments_count
+		SELECT p.id, p.user_id, p.title, p.content, p.tags, p.status, p.edited_at, p.created_at, p.updated_at, u.id, u.username,
+       		COUNT(c.id) AS comments_count, ` + reactionSummaryColumns("p.id", "$1") + `
 		FROM posts p
+		JOIN users u ON u.id = p.user_id
 		LEFT JOIN comments c ON p.id = c.post_id
-		LEFT JOIN users u ON p.user_id = u.id
-		JOIN followers f ON f.follower_id = p.user_id OR p.user_id = $1
 		WHERE 
-		    f.user_id = $1
+		    p.status = 'published'
+		  AND
+		    (p.user_id = $1 OR EXISTS (
+		        SELECT 1 FROM followers f WHERE f.user_id = p.user_id AND f.follower_id = $1
+		    ))
 		  AND 
-		  	(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%')
+		  	($4 = '' OR p.search_vector @@ websearch_to_tsquery('english', $4))
+		  AND
+		   (cardinality($5::varchar[]) = 0 OR p.tags @> $5)
+		  AND
+		   (cardinality($8::bigint[]) = 0 OR p.user_id = ANY($8))
+		  AND
+		   ($9::timestamptz IS NULL OR p.created_at >= $9)
 		  AND
-		   (p.tags @> $5 OR $5 = '{}')
-		GROUP BY p.id, p.user_id, p.title, p.content, p.tags, p.created_at, p.updated_at, u.id, u.email
-		ORDER BY p.created_at ` + fq.Sort + `
+		   ($10::timestamptz IS NULL OR p.created_at < $10)
+		  AND
+		   NOT EXISTS (SELECT 1 FROM user_mutes m WHERE m.muter_id = $1 AND m.muted_id = p.user_id)
+		  AND
+		   ($6::timestamptz IS NULL OR (p.created_at, p.id) ` + keysetOperator + ` ($6, $7))
+		GROUP BY p.id, u.id
+		ORDER BY p.created_at ` + fq.Sort + `, p.id ` + fq.Sort + `
 		LIMIT $2 OFFSET $3
 	`
 
+	// a NULL array would not match the cardinality checks
+	tags, authors := fq.Tags, fq.Authors
+	if tags == nil {
+		tags = []string{}
+	}
+
+	if authors == nil {
+		authors = []int64{}
+	}
+
+	cursorTime, cursorID := cursorArgs(fq.Cursor)
+
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, fq.Offset, fq.Search, pq.Array(fq.Tags))
+	rows, err := s.db.QueryContext(
+		ctx,
+		query,
+		userID,
+		fq.Limit,
+		fq.Offset,
+		fq.Search,
+		pq.Array(tags),
+		cursorTime,
+		cursorID,
+		pq.Array(authors),
+		fq.Since,
+		fq.Until,
+	)
 	if err != nil {
 		return nil, err
 	}
 
 	defer rows.Close()
 
-	var feed []PostWithMetaData
+	feed := []PostWithMetaData{}
 	for rows.Next() {
 		var p PostWithMetaData
+		var reactionCounts []byte
 		err := rows.Scan(
 			&p.ID,
 			&p.UserID,
 			&p.Title,
 			&p.Content,
 			pq.Array(&p.Tags),
+			&p.Status,
+			&p.EditedAt,
 			&p.CreatedAt,
 			&p.UpdatedAt,
 			&p.User.ID,
-			&p.User.Email,
+			&p.User.Username,
 			&p.CommentsCount,
+			&reactionCounts,
+			pq.Array(&p.Reactions.ViewerReactions),
 		)
 
 		if err != nil {
 			return nil, err
 		}
 
+		if err := p.Reactions.fill(reactionCounts); err != nil {
+			return nil, err
+		}
+
 		feed = append(feed, p)
 	}
 
-	return feed, nil
+	return feed, rows.Err()
 }
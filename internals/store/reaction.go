@@ -0,0 +1,145 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrInvalidReaction = errors.New("invalid reaction kind")
+)
+
+// ReactionKinds are the reactions a post accepts, kept in sync with the
+// chk_reaction_kind constraint.
+var ReactionKinds = map[string]bool{
+	"like":  true,
+	"love":  true,
+	"laugh": true,
+	"wow":   true,
+	"sad":   true,
+	"angry": true,
+}
+
+// ReactionSummary is what a viewer sees of the reactions on a post.
+type ReactionSummary struct {
+	Counts          map[string]int64 `json:"counts"`
+	Reacted         bool             `json:"reacted"`
+	ViewerReactions []string         `json:"viewer_reactions"`
+}
+
+type ReactionStore struct {
+	db *sql.DB
+}
+
+// Add is idempotent, reacting twice with the same kind is not an error.
+func (s *ReactionStore) Add(ctx context.Context, postID, userID int64, kind string) error {
+
+	if !ReactionKinds[kind] {
+		return ErrInvalidReaction
+	}
+
+	query := `
+		INSERT INTO reactions (post_id, user_id, kind)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (post_id, user_id, kind) DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, postID, userID, kind)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *ReactionStore) Remove(ctx context.Context, postID, userID int64, kind string) error {
+
+	if !ReactionKinds[kind] {
+		return ErrInvalidReaction
+	}
+
+	query := `DELETE FROM reactions WHERE post_id = $1 AND user_id = $2 AND kind = $3`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, postID, userID, kind)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *ReactionStore) GetSummary(ctx context.Context, postID, viewerID int64) (*ReactionSummary, error) {
+
+	query := `
+		SELECT ` + reactionSummaryColumns("$1", "$2") + `
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var counts []byte
+	summary := &ReactionSummary{}
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		postID,
+		viewerID,
+	).Scan(
+		&counts,
+		pq.Array(&summary.ViewerReactions),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := summary.fill(counts); err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// reactionSummaryColumns selects the per kind counts as a json object and the
+// kinds the viewer reacted with, for the post and viewer given as sql
+// expressions, so post listings can embed them in their own query.
+func reactionSummaryColumns(postID, viewerID string) string {
+	return `
+		COALESCE((
+		    SELECT jsonb_object_agg(k.kind, k.total)
+		    FROM (
+		        SELECT r.kind, COUNT(*) AS total
+		        FROM reactions r
+		        WHERE r.post_id = ` + postID + `
+		        GROUP BY r.kind
+		    ) k
+		), '{}'::jsonb),
+		ARRAY(
+		    SELECT r.kind FROM reactions r
+		    WHERE r.post_id = ` + postID + ` AND r.user_id = ` + viewerID + `
+		    ORDER BY r.kind
+		)`
+}
+
+func (summary *ReactionSummary) fill(counts []byte) error {
+	if err := json.Unmarshal(counts, &summary.Counts); err != nil {
+		return err
+	}
+
+	if summary.ViewerReactions == nil {
+		summary.ViewerReactions = []string{}
+	}
+
+	summary.Reacted = len(summary.ViewerReactions) > 0
+
+	return nil
+}
@@ -0,0 +1,226 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrRefreshTokenReused = errors.New("refresh token has already been used")
+)
+
+// RefreshToken is a single link in a rotation chain. Every token issued from
+// the same login shares a FamilyID, which is also carried by the access
+// tokens so the whole session can be revoked at once.
+type RefreshToken struct {
+	Token     string       `json:"-"`
+	UserID    int64        `json:"user_id"`
+	FamilyID  string       `json:"family_id"`
+	ExpiredAt time.Time    `json:"expired_at"`
+	UsedAt    sql.NullTime `json:"used_at"`
+	RevokedAt sql.NullTime `json:"revoked_at"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+type RefreshTokenStore struct {
+	db *sql.DB
+}
+
+func (s *RefreshTokenStore) Create(ctx context.Context, token *RefreshToken) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.create(ctx, tx, token)
+	})
+}
+
+func (s *RefreshTokenStore) create(ctx context.Context, tx *sql.Tx, token *RefreshToken) error {
+
+	query := `
+		INSERT INTO refresh_tokens (token, user_id, family_id, expired_at)
+		VALUES ($1, $2, $3, $4) RETURNING created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := tx.QueryRowContext(
+		ctx,
+		query,
+		token.Token,
+		token.UserID,
+		token.FamilyID,
+		token.ExpiredAt,
+	).Scan(
+		&token.CreatedAt,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Rotate exchanges the refresh token identified by hashToken for next, which
+// inherits its family. Presenting a token that was already rotated means it
+// leaked, so the whole family is revoked and ErrRefreshTokenReused returned.
+func (s *RefreshTokenStore) Rotate(ctx context.Context, hashToken string, next *RefreshToken) error {
+
+	reused := false
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+
+		current, err := s.getForUpdate(ctx, tx, hashToken)
+		if err != nil {
+			return err
+		}
+
+		if current.RevokedAt.Valid || current.ExpiredAt.Before(time.Now()) {
+			return ErrNotFound
+		}
+
+		if current.UsedAt.Valid {
+			reused = true
+			return s.revokeFamily(ctx, tx, current.FamilyID)
+		}
+
+		if err := s.markUsed(ctx, tx, hashToken); err != nil {
+			return err
+		}
+
+		next.UserID = current.UserID
+		next.FamilyID = current.FamilyID
+
+		return s.create(ctx, tx, next)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if reused {
+		return ErrRefreshTokenReused
+	}
+
+	return nil
+}
+
+func (s *RefreshTokenStore) getForUpdate(ctx context.Context, tx *sql.Tx, hashToken string) (*RefreshToken, error) {
+
+	query := `
+		SELECT token, user_id, family_id, expired_at, used_at, revoked_at, created_at
+		FROM refresh_tokens
+		WHERE token = $1
+		FOR UPDATE
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	token := &RefreshToken{}
+	err := tx.QueryRowContext(
+		ctx,
+		query,
+		hashToken,
+	).Scan(
+		&token.Token,
+		&token.UserID,
+		&token.FamilyID,
+		&token.ExpiredAt,
+		&token.UsedAt,
+		&token.RevokedAt,
+		&token.CreatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return token, nil
+}
+
+func (s *RefreshTokenStore) markUsed(ctx context.Context, tx *sql.Tx, hashToken string) error {
+
+	query := `UPDATE refresh_tokens SET used_at = NOW() WHERE token = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, hashToken)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *RefreshTokenStore) RevokeFamily(ctx context.Context, familyID string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.revokeFamily(ctx, tx, familyID)
+	})
+}
+
+func (s *RefreshTokenStore) revokeFamily(ctx context.Context, tx *sql.Tx, familyID string) error {
+
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, familyID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *RefreshTokenStore) revokeAllForUser(ctx context.Context, tx *sql.Tx, userID int64) error {
+
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *RefreshTokenStore) IsFamilyRevoked(ctx context.Context, familyID string) (bool, error) {
+
+	query := `
+		SELECT NOT EXISTS (
+		    SELECT 1 FROM refresh_tokens
+		    WHERE family_id = $1 AND revoked_at IS NULL
+		)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var revoked bool
+	err := s.db.QueryRowContext(ctx, query, familyID).Scan(&revoked)
+	if err != nil {
+		return false, err
+	}
+
+	return revoked, nil
+}
@@ -0,0 +1,207 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"slices"
+	"time"
+)
+
+// PostRevision is what a post looked like before one of its edits, and who
+// made that edit. EditorID is nil once the editor deleted their account.
+type PostRevision struct {
+	ID             int64     `json:"id"`
+	PostID         int64     `json:"post_id"`
+	EditorID       *int64    `json:"editor_id"`
+	EditorUsername *string   `json:"editor_username"`
+	Title          string    `json:"title"`
+	Content        string    `json:"content"`
+	Tags           []string  `json:"tags"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// GetRevisions lists the revisions of a post, the most recent first.
+func (s *PostStore) GetRevisions(ctx context.Context, postID int64, rq PaginatedRevisionQuery) ([]PostRevision, error) {
+
+	query := `
+		SELECT r.id, r.post_id, r.editor_id, u.username, r.title, r.content, r.tags, r.created_at
+		FROM post_revisions r
+		LEFT JOIN users u ON u.id = r.editor_id
+		WHERE r.post_id = $1
+		  AND ($3::timestamptz IS NULL OR (r.created_at, r.id) < ($3, $4))
+		ORDER BY r.created_at DESC, r.id DESC
+		LIMIT $2
+	`
+
+	cursorTime, cursorID := cursorArgs(rq.Cursor)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, postID, rq.Limit, cursorTime, cursorID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	revisions := []PostRevision{}
+	for rows.Next() {
+		var rev PostRevision
+		err := rows.Scan(
+			&rev.ID,
+			&rev.PostID,
+			&rev.EditorID,
+			&rev.EditorUsername,
+			&rev.Title,
+			&rev.Content,
+			pq.Array(&rev.Tags),
+			&rev.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
+}
+
+// RestoreRevision puts the title, content and tags of a revision back on
+// the post. It is an edit like any other, the version it replaces becomes a
+// revision in turn so a restore can itself be undone.
+func (s *PostStore) RestoreRevision(ctx context.Context, post *Post, revisionID int64, editorID int64) error {
+
+	query := `
+		SELECT title, content, tags
+		FROM post_revisions
+		WHERE id = $1 AND post_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, revisionID, post.ID).Scan(
+			&post.Title,
+			&post.Content,
+			pq.Array(&post.Tags),
+		)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		// a restore brings back the text, never the status
+		post.Status, post.PublishAt = "", nil
+
+		_, err = updatePost(ctx, tx, post, editorID)
+		return err
+	})
+}
+
+// updatePost saves post, recording its previous title, content and tags as
+// a revision when they changed. Only changes to a published post are kept
+// as revisions and mark it as edited, drafts are expected to change before
+// they go out and what they held is nobody else's business.
+//
+// The status is checked against the one of the locked row, so an edit racing
+// the scheduler cannot bring a post it just published back to scheduled. An
+// empty Status keeps the current status and publish_at. published tells
+// whether this edit is the one that published the post.
+func updatePost(ctx context.Context, tx *sql.Tx, post *Post, editorID int64) (published bool, err error) {
+
+	currentQuery := `
+		SELECT title, content, tags, status, publish_at
+		FROM posts
+		WHERE id = $1
+		FOR UPDATE
+	`
+
+	revisionQuery := `
+		INSERT INTO post_revisions (post_id, editor_id, title, content, tags)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	updateQuery := `
+		UPDATE posts
+		SET title = $1, content = $2, tags = $3, status = $4, publish_at = $5, updated_at = NOW(),
+		    edited_at = CASE WHEN $6 AND status = 'published' THEN NOW() ELSE edited_at END,
+		    created_at = CASE WHEN status != 'published' AND $4::varchar = 'published' THEN NOW() ELSE created_at END
+		WHERE id = $7
+		RETURNING created_at, updated_at, edited_at
+	`
+
+	var current Post
+	err = tx.QueryRowContext(ctx, currentQuery, post.ID).Scan(
+		&current.Title,
+		&current.Content,
+		pq.Array(&current.Tags),
+		&current.Status,
+		&current.PublishAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, ErrNotFound
+		default:
+			return false, err
+		}
+	}
+
+	if post.Status == "" {
+		post.Status, post.PublishAt = current.Status, current.PublishAt
+	}
+
+	if current.Status == PostStatusPublished && post.Status != PostStatusPublished {
+		return false, ErrAlreadyPublished
+	}
+
+	// a NULL array would break the NOT NULL tags columns
+	if post.Tags == nil {
+		post.Tags = []string{}
+	}
+
+	if current.Tags == nil {
+		current.Tags = []string{}
+	}
+
+	changed := current.Title != post.Title ||
+		current.Content != post.Content ||
+		!slices.Equal(current.Tags, post.Tags)
+
+	if changed && current.Status == PostStatusPublished {
+		_, err := tx.ExecContext(ctx, revisionQuery, post.ID, editorID, current.Title, current.Content, pq.Array(current.Tags))
+		if err != nil {
+			return false, err
+		}
+	}
+
+	err = tx.QueryRowContext(
+		ctx,
+		updateQuery,
+		post.Title,
+		post.Content,
+		pq.Array(post.Tags),
+		post.Status,
+		post.PublishAt,
+		changed,
+		post.ID,
+	).Scan(
+		&post.CreatedAt,
+		&post.UpdatedAt,
+		&post.EditedAt,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return current.Status != PostStatusPublished && post.Status == PostStatusPublished, nil
+}
@@ -0,0 +1,157 @@
+package store
+
+import (
+	"context"
+	"github.com/lib/pq"
+	"strings"
+)
+
+// headlineOptions mark the matched words of a snippet so clients can
+// highlight them.
+const headlineOptions = `StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2`
+
+// PostSearchResult is a post matching a search, with the snippets of its
+// title and content where the terms were found.
+type PostSearchResult struct {
+	Post
+	Rank             float32 `json:"rank"`
+	TitleHighlight   string  `json:"title_highlight"`
+	ContentHighlight string  `json:"content_highlight"`
+}
+
+// Search finds the posts viewerID may see matching sq.Query, which accepts
+// the web search syntax: quoted phrases, OR and -excluded words. The best
+// matches come first.
+func (s *PostStore) Search(ctx context.Context, viewerID int64, sq PaginatedSearchQuery) ([]PostSearchResult, error) {
+
+	query := `
+		SELECT p.id, p.user_id, p.title, p.content, p.tags, p.status, p.edited_at, p.created_at, p.updated_at, u.id, u.username,
+		    ts_rank(p.search_vector, q.query) AS rank,
+		    ts_headline('english', p.title, q.query, 'HighlightAll=true'),
+		    ts_headline('english', p.content, q.query, '` + headlineOptions + `')
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		CROSS JOIN websearch_to_tsquery('english', $2) AS q(query)
+		WHERE p.search_vector @@ q.query
+		  AND p.status = 'published'
+		  AND (NOT u.is_private OR p.user_id = $1 OR EXISTS (
+		      SELECT 1 FROM followers pf WHERE pf.user_id = p.user_id AND pf.follower_id = $1
+		  ))
+		  AND NOT EXISTS (SELECT 1 FROM user_mutes m WHERE m.muter_id = $1 AND m.muted_id = p.user_id)
+		  AND NOT EXISTS (
+		      SELECT 1 FROM user_blocks b
+		      WHERE (b.blocker_id = $1 AND b.blocked_id = p.user_id) OR (b.blocker_id = p.user_id AND b.blocked_id = $1)
+		  )
+		ORDER BY rank DESC, p.created_at DESC, p.id DESC
+		LIMIT $3 OFFSET $4
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, viewerID, sq.Query, sq.Limit, sq.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	results := []PostSearchResult{}
+	for rows.Next() {
+		var p PostSearchResult
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			pq.Array(&p.Tags),
+			&p.Status,
+			&p.EditedAt,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			&p.User.ID,
+			&p.User.Username,
+			&p.Rank,
+			&p.TitleHighlight,
+			&p.ContentHighlight,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, p)
+	}
+
+	return results, rows.Err()
+}
+
+// Search finds the users whose username starts with sq.Query. An email is
+// only matched when the query is the whole address, so the endpoint can
+// find someone by a known address but cannot be used to guess one a prefix
+// at a time, and emails are never returned.
+func (s *UserStore) Search(ctx context.Context, viewerID int64, sq PaginatedSearchQuery) ([]PublicUser, error) {
+
+	query := `
+		SELECT u.id, u.username, u.display_name, u.bio, u.avatar_url, u.is_private, u.created_at
+		FROM users u
+		WHERE u.email_verified_at IS NOT NULL
+		  AND (
+		      lower(u.username::text) LIKE lower($2::text) || '%'
+		      OR ($3 AND lower(u.email::text) = lower($4::text))
+		  )
+		  AND NOT EXISTS (
+		      SELECT 1 FROM user_blocks b
+		      WHERE (b.blocker_id = $1 AND b.blocked_id = u.id) OR (b.blocker_id = u.id AND b.blocked_id = $1)
+		  )
+		ORDER BY lower(u.username::text) = lower($4::text) DESC, length(u.username), u.username
+		LIMIT $5 OFFSET $6
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		query,
+		viewerID,
+		escapeLike(sq.Query),
+		strings.Contains(sq.Query, "@"),
+		sq.Query,
+		sq.Limit,
+		sq.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	users := []PublicUser{}
+	for rows.Next() {
+		var u PublicUser
+		err := rows.Scan(
+			&u.ID,
+			&u.Username,
+			&u.DisplayName,
+			&u.Bio,
+			&u.AvatarURL,
+			&u.IsPrivate,
+			&u.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike makes s match literally in a LIKE pattern, underscores are
+// common in usernames.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -18,35 +18,110 @@ type Storage struct {
 	Posts interface {
 		Create(context.Context, *Post) error
 		GetPostByID(context.Context, int64) (*Post, error)
-		Update(context.Context, *Post) error
+		Update(context.Context, *Post, int64) (bool, error)
 		Delete(context.Context, int64) error
 		GetUserFeed(context.Context, int64, PaginatedFeedQuery) ([]PostWithMetaData, error)
+		Search(context.Context, int64, PaginatedSearchQuery) ([]PostSearchResult, error)
+		GetFeedEntries(context.Context, int64, FeedEntryQuery) ([]FeedEntry, error)
+		GetFeedByIDs(context.Context, int64, []int64) ([]PostWithMetaData, error)
+		GetFeedCandidates(context.Context, int64, time.Duration, int) ([]FeedCandidate, error)
+		GetDrafts(context.Context, int64, PaginatedDraftQuery) ([]Post, error)
+		PublishDue(context.Context, int) ([]Post, error)
+		GetRevisions(context.Context, int64, PaginatedRevisionQuery) ([]PostRevision, error)
+		RestoreRevision(context.Context, *Post, int64, int64) error
 	}
 	Users interface {
 		GetUserByID(context.Context, int64) (*User, error)
 		GetByEmail(context.Context, string) (*User, error)
-		CreateAndInvite(context.Context, *User, string, time.Duration) error
+		GetByUsername(context.Context, string) (*User, error)
+		UpdateProfile(context.Context, *User) error
+		GetStats(context.Context, int64) (*UserStats, error)
+		Search(context.Context, int64, PaginatedSearchQuery) ([]PublicUser, error)
+		CreateAndInvite(context.Context, *User, string, time.Duration, func(*User) error) error
 		Activate(context.Context, string) error
+		ReissueInvitation(context.Context, string, string, time.Duration) (*User, error)
+		DeleteExpiredInvitations(context.Context) (int64, error)
+		DeleteUnverified(context.Context, time.Duration) (int64, error)
+		CreatePasswordReset(context.Context, *User, string, time.Duration) error
+		ResetPassword(context.Context, string, string) error
 	}
 	Comment interface {
-		GetByPostID(context.Context, int64) ([]Comment, error)
+		Create(context.Context, *Comment) error
+		GetByID(context.Context, int64) (*Comment, error)
+		GetByPostID(context.Context, int64, int64) ([]Comment, error)
+		Update(context.Context, *Comment) error
+		Delete(context.Context, int64) error
 	}
 	Followers interface {
-		Follow(context.Context, int64, int64) error
+		Follow(context.Context, int64, int64) (bool, error)
 		Unfollow(context.Context, int64, int64) error
+		GetFollowers(context.Context, int64, PaginatedFollowQuery) ([]FollowListEntry, error)
+		GetFollowing(context.Context, int64, PaginatedFollowQuery) ([]FollowListEntry, error)
+		GetRelationship(context.Context, int64, int64) (*Relationship, error)
+		CanSeePosts(context.Context, int64, int64) (bool, error)
+		GetFeedAuthorIDs(context.Context, int64) ([]int64, error)
+		GetFanoutTargets(context.Context, int64, int) ([]int64, bool, error)
+		GetFollowRequests(context.Context, int64, PaginatedFollowQuery) ([]FollowRequest, error)
+		ApproveFollowRequest(context.Context, int64, int64) error
+		RejectFollowRequest(context.Context, int64, int64) error
+	}
+	Blocks interface {
+		Block(context.Context, int64, int64) error
+		Unblock(context.Context, int64, int64) error
+	}
+	Mutes interface {
+		Mute(context.Context, int64, int64) error
+		Unmute(context.Context, int64, int64) error
+	}
+	Conversations interface {
+		GetOrCreateDirect(context.Context, int64, int64) (*Conversation, bool, error)
+		GetByID(context.Context, int64, int64) (*Conversation, error)
+		GetForUser(context.Context, int64, PaginatedConversationQuery) ([]Conversation, error)
+		SendMessage(context.Context, *Message) error
+		GetMessages(context.Context, int64, PaginatedConversationQuery) ([]Message, error)
+		MarkRead(context.Context, int64, int64, int64) (int64, error)
+	}
+	Notifications interface {
+		Create(context.Context, *Notification) error
+		CreateMentions(context.Context, *Notification, string) error
+		GetGroups(context.Context, int64, PaginatedNotificationQuery) ([]NotificationGroup, error)
+		CountUnread(context.Context, int64) (int64, error)
+		MarkRead(context.Context, int64, []int64) (int64, error)
+	}
+	Tags interface {
+		GetPosts(context.Context, int64, string, PaginatedTagQuery) ([]Post, error)
+		GetTrending(context.Context, time.Duration, int) ([]TrendingTag, error)
 	}
 	Roles interface {
 		GetByName(context.Context, string) (*Roles, error)
 	}
+	Reactions interface {
+		Add(context.Context, int64, int64, string) error
+		Remove(context.Context, int64, int64, string) error
+		GetSummary(context.Context, int64, int64) (*ReactionSummary, error)
+	}
+	RefreshTokens interface {
+		Create(context.Context, *RefreshToken) error
+		Rotate(context.Context, string, *RefreshToken) error
+		RevokeFamily(context.Context, string) error
+		IsFamilyRevoked(context.Context, string) (bool, error)
+	}
 }
 
 func NewStorage(db *sql.DB) Storage {
 	return Storage{
-		Posts:     &PostStore{db: db},
-		Users:     &UserStore{db: db},
-		Comment:   &CommentStore{db},
-		Followers: &FollowStore{db},
-		Roles:     &RoleStore{db},
+		Posts:         &PostStore{db: db},
+		Users:         &UserStore{db: db},
+		Comment:       &CommentStore{db},
+		Followers:     &FollowStore{db},
+		Blocks:        &BlockStore{db},
+		Mutes:         &MuteStore{db},
+		Conversations: &ConversationStore{db},
+		Notifications: &NotificationStore{db},
+		Tags:          &TagStore{db},
+		Roles:         &RoleStore{db},
+		Reactions:     &ReactionStore{db},
+		RefreshTokens: &RefreshTokenStore{db},
 	}
 }
 
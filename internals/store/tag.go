@@ -0,0 +1,179 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidTag  = errors.New("tags may only hold letters, digits and underscores, up to 50 of them")
+	ErrTooManyTags = errors.New("a post cannot have more than 10 tags")
+)
+
+// MaxPostTags is how many tags a post may have, hashtags in its content
+// included.
+const MaxPostTags = 10
+
+var (
+	tagRegex     = regexp.MustCompile(`^[\p{L}\p{N}_]{1,50}$`)
+	hashtagRegex = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&])#([\p{L}\p{N}_]{1,50})`)
+)
+
+// TrendingTag is a tag with how much it was used over a window of time.
+type TrendingTag struct {
+	Tag     string `json:"tag"`
+	Posts   int64  `json:"posts"`
+	Authors int64  `json:"authors"`
+}
+
+type TagStore struct {
+	db *sql.DB
+}
+
+// NormalizeTags returns tags the way they are stored: without a leading
+// "#", lowercased and without duplicates, in the order first given. It
+// never returns a nil slice, a NULL tags column would not match any filter.
+func NormalizeTags(tags []string) ([]string, error) {
+
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+
+		if !tagRegex.MatchString(tag) {
+			return nil, ErrInvalidTag
+		}
+
+		if seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+
+	if len(normalized) > MaxPostTags {
+		return nil, ErrTooManyTags
+	}
+
+	return normalized, nil
+}
+
+// ExtractHashtags returns the #hashtags written in text, as given. "&#39;"
+// style entities and "a#b" are not hashtags.
+func ExtractHashtags(text string) []string {
+
+	var tags []string
+	for _, match := range hashtagRegex.FindAllStringSubmatch(text, -1) {
+		tags = append(tags, match[1])
+	}
+
+	return tags
+}
+
+// GetPosts lists the posts tagged with tag, the newest first. Only posts of
+// public accounts are browsable by tag, and the viewer does not see the
+// authors they muted or share a block with.
+func (s *TagStore) GetPosts(ctx context.Context, viewerID int64, tag string, tq PaginatedTagQuery) ([]Post, error) {
+
+	query := `
+		SELECT p.id, p.user_id, p.title, p.content, p.tags, p.status, p.edited_at, p.created_at, p.updated_at, u.id, u.username
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.tags @> ARRAY[$2]::varchar[]
+		  AND p.status = 'published'
+		  AND NOT u.is_private
+		  AND NOT EXISTS (SELECT 1 FROM user_mutes m WHERE m.muter_id = $1 AND m.muted_id = p.user_id)
+		  AND NOT EXISTS (
+		      SELECT 1 FROM user_blocks b
+		      WHERE (b.blocker_id = $1 AND b.blocked_id = p.user_id) OR (b.blocker_id = p.user_id AND b.blocked_id = $1)
+		  )
+		  AND ($4::timestamptz IS NULL OR (p.created_at, p.id) < ($4, $5))
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $3
+	`
+
+	cursorTime, cursorID := cursorArgs(tq.Cursor)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, viewerID, tag, tq.Limit, cursorTime, cursorID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		var p Post
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			pq.Array(&p.Tags),
+			&p.Status,
+			&p.EditedAt,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			&p.User.ID,
+			&p.User.Username,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		posts = append(posts, p)
+	}
+
+	return posts, rows.Err()
+}
+
+// GetTrending ranks the tags used on public posts within the last window.
+// A tag used by many authors ranks above one a single author keeps
+// repeating.
+func (s *TagStore) GetTrending(ctx context.Context, window time.Duration, limit int) ([]TrendingTag, error) {
+
+	query := `
+		SELECT t.tag, COUNT(*) AS posts, COUNT(DISTINCT p.user_id) AS authors
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		CROSS JOIN unnest(p.tags) AS t(tag)
+		WHERE p.created_at > NOW() - make_interval(secs => $1)
+		  AND p.status = 'published'
+		  AND NOT u.is_private
+		GROUP BY t.tag
+		ORDER BY authors DESC, posts DESC, t.tag
+		LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, window.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tags := []TrendingTag{}
+	for rows.Next() {
+		var t TrendingTag
+		if err := rows.Scan(&t.Tag, &t.Posts, &t.Authors); err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
@@ -0,0 +1,186 @@
+package store
+
+import (
+	"context"
+	"github.com/lib/pq"
+	"time"
+)
+
+// FeedEntry is a post as kept in a precomputed timeline, enough to order
+// and page through it.
+type FeedEntry struct {
+	ID        int64
+	CreatedAt time.Time
+}
+
+// FeedEntryQuery selects the feed entries of a user. Authors with more than
+// FanoutMaxFollowers followers are not fanned out on write, their posts are
+// pulled at read time instead. Pulled picks which of the two sets is listed.
+type FeedEntryQuery struct {
+	Limit              int
+	Cursor             *Cursor
+	FanoutMaxFollowers int
+	Pulled             bool
+}
+
+// GetFeedEntries lists the newest feed entries of userID, the ones of the
+// authors pushed to timelines or those of the authors pulled at read time.
+func (s *PostStore) GetFeedEntries(ctx context.Context, userID int64, eq FeedEntryQuery) ([]FeedEntry, error) {
+
+	// the follower count is kept on users, so telling pushed authors from
+	// pulled ones costs a row per followed account rather than a count
+	query := `
+		WITH authors AS (
+		    SELECT $1::bigint AS id
+		    UNION
+		    SELECT f.user_id FROM followers f WHERE f.follower_id = $1
+		)
+		SELECT p.id, p.created_at
+		FROM authors a
+		JOIN users u ON u.id = a.id
+		JOIN posts p ON p.user_id = a.id
+		WHERE p.status = 'published'
+		  AND (u.followers_count > $2::int) = $3
+		  AND NOT EXISTS (SELECT 1 FROM user_mutes m WHERE m.muter_id = $1 AND m.muted_id = a.id)
+		  AND ($5::timestamptz IS NULL OR (p.created_at, p.id) < ($5, $6))
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $4
+	`
+
+	cursorTime, cursorID := cursorArgs(eq.Cursor)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, eq.FanoutMaxFollowers, eq.Pulled, eq.Limit, cursorTime, cursorID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	entries := []FeedEntry{}
+	for rows.Next() {
+		var e FeedEntry
+		if err := rows.Scan(&e.ID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// GetFeedByIDs loads the feed posts with the given ids, newest first, the
+// way GetUserFeed returns them. Posts deleted since their ids were read are
+// left out.
+func (s *PostStore) GetFeedByIDs(ctx context.Context, viewerID int64, ids []int64) ([]PostWithMetaData, error) {
+
+	if len(ids) == 0 {
+		return []PostWithMetaData{}, nil
+	}
+
+	query := `
+		SELECT p.id, p.user_id, p.title, p.content, p.tags, p.status, p.edited_at, p.created_at, p.updated_at, u.id, u.username,
+		    COUNT(c.id) AS comments_count, ` + reactionSummaryColumns("p.id", "$1") + `
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		LEFT JOIN comments c ON p.id = c.post_id
+		WHERE p.id = ANY($2)
+		  AND p.status = 'published'
+		  AND NOT EXISTS (SELECT 1 FROM user_mutes m WHERE m.muter_id = $1 AND m.muted_id = p.user_id)
+		GROUP BY p.id, u.id
+		ORDER BY p.created_at DESC, p.id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, viewerID, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	feed := []PostWithMetaData{}
+	for rows.Next() {
+		var p PostWithMetaData
+		var reactionCounts []byte
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			pq.Array(&p.Tags),
+			&p.Status,
+			&p.EditedAt,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			&p.User.ID,
+			&p.User.Username,
+			&p.CommentsCount,
+			&reactionCounts,
+			pq.Array(&p.Reactions.ViewerReactions),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.Reactions.fill(reactionCounts); err != nil {
+			return nil, err
+		}
+
+		feed = append(feed, p)
+	}
+
+	return feed, rows.Err()
+}
+
+// GetFanoutTargets returns the users whose timelines a post of authorID is
+// pushed to: the author and the followers who did not mute them. fanout is
+// false, and no user returned, when the author has more than maxFollowers
+// followers.
+func (s *FollowStore) GetFanoutTargets(ctx context.Context, authorID int64, maxFollowers int) (userIDs []int64, fanout bool, err error) {
+
+	countQuery := `SELECT followers_count FROM users WHERE id = $1`
+
+	query := `
+		SELECT $1::bigint
+		UNION
+		SELECT f.follower_id FROM followers f
+		WHERE f.user_id = $1
+		  AND NOT EXISTS (SELECT 1 FROM user_mutes m WHERE m.muter_id = f.follower_id AND m.muted_id = $1)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var followers int
+	if err := s.db.QueryRowContext(ctx, countQuery, authorID).Scan(&followers); err != nil {
+		return nil, false, err
+	}
+
+	if followers > maxFollowers {
+		return nil, false, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, authorID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, false, err
+		}
+
+		userIDs = append(userIDs, id)
+	}
+
+	return userIDs, true, rows.Err()
+}
@@ -13,17 +13,55 @@ import (
 )
 
 var (
-	ErrDuplicateEmail = errors.New("the email already exists")
+	ErrDuplicateEmail    = errors.New("the email already exists")
+	ErrDuplicateUsername = errors.New("the username already exists")
+)
+
+// One time passwords are shared by several flows, the purpose keeps a
+// password reset token from activating an account and vice versa.
+const (
+	OTPPurposeActivation    = "activation"
+	OTPPurposePasswordReset = "password_reset"
 )
 
 type User struct {
-	ID              int64        `json:"id"`
-	Email           string       `json:"email"`
-	Password        password     `json:"-"`
-	EmailVerifiedAt sql.NullTime `json:"email_verified_at"`
-	CreatedAt       time.Time    `json:"created_at"`
-	UpdatedAt       time.Time    `json:"updated_at"`
-	Role            Roles        `json:"roles"`
+	ID                    int64        `json:"id"`
+	Email                 string       `json:"email,omitempty"`
+	Username              string       `json:"username"`
+	DisplayName           string       `json:"display_name"`
+	Bio                   string       `json:"bio"`
+	AvatarURL             string       `json:"avatar_url"`
+	IsPrivate             bool         `json:"is_private"`
+	MessagesFollowersOnly bool         `json:"messages_followers_only"`
+	Password              password     `json:"-"`
+	EmailVerifiedAt       sql.NullTime `json:"email_verified_at"`
+	CreatedAt             time.Time    `json:"created_at"`
+	UpdatedAt             time.Time    `json:"updated_at"`
+	Role                  Roles        `json:"roles"`
+}
+
+// PublicUser is the part of a user anyone may see. It never carries the
+// email or anything else only the user themselves should know.
+type PublicUser struct {
+	ID          int64     `json:"id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	AvatarURL   string    `json:"avatar_url"`
+	IsPrivate   bool      `json:"is_private"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (u *User) Public() PublicUser {
+	return PublicUser{
+		ID:          u.ID,
+		Username:    u.Username,
+		DisplayName: u.DisplayName,
+		Bio:         u.Bio,
+		AvatarURL:   u.AvatarURL,
+		IsPrivate:   u.IsPrivate,
+		CreatedAt:   u.CreatedAt,
+	}
 }
 
 type password struct {
@@ -63,8 +101,8 @@ func (s *UserStore) create(ctx context.Context, tx *sql.Tx, user *User) error {
 		    FROM roles
 		    WHERE name = $3
 		)
-		INSERT INTO users (email, password, role_id) 
-		VALUES (LOWER($1), $2, (SELECT id FROM role))
+		INSERT INTO users (email, password, role_id, username, display_name)
+		VALUES (LOWER($1), $2, (SELECT id FROM role), $4, $5)
 		RETURNING id, email_verified_at, created_at, updated_at,
 		    (SELECT id FROM role),
 		    (SELECT level FROM role),
@@ -80,6 +118,8 @@ func (s *UserStore) create(ctx context.Context, tx *sql.Tx, user *User) error {
 		user.Email,
 		user.Password.Hash,
 		user.Role.Name,
+		user.Username,
+		user.DisplayName,
 	).Scan(
 		&user.ID,
 		&user.EmailVerifiedAt,
@@ -97,6 +137,9 @@ func (s *UserStore) create(ctx context.Context, tx *sql.Tx, user *User) error {
 			if pqErr.Code == "23505" && pqErr.Constraint == "users_email_key" {
 				return ErrDuplicateEmail
 			}
+			if pqErr.Code == "23505" && pqErr.Constraint == "users_username_key" {
+				return ErrDuplicateUsername
+			}
 		}
 		return err
 	}
@@ -132,7 +175,7 @@ func (s *UserStore) update(ctx context.Context, tx *sql.Tx, user *User) error {
 
 func (s *UserStore) GetUserByID(ctx context.Context, id int64) (*User, error) {
 	query := `
-		SELECT u.id, u.email, u.email_verified_at, u.created_at, u.updated_at, role_id, r.name, r.description, r.level
+		SELECT u.id, u.email, u.username, u.display_name, u.bio, u.avatar_url, u.is_private, u.messages_followers_only, u.email_verified_at, u.created_at, u.updated_at, role_id, r.name, r.description, r.level
 		FROM users u
 		JOIN roles r ON u.role_id = r.id
 		WHERE u.id = $1
@@ -148,6 +191,12 @@ func (s *UserStore) GetUserByID(ctx context.Context, id int64) (*User, error) {
 	).Scan(
 		&user.ID,
 		&user.Email,
+		&user.Username,
+		&user.DisplayName,
+		&user.Bio,
+		&user.AvatarURL,
+		&user.IsPrivate,
+		&user.MessagesFollowersOnly,
 		&user.EmailVerifiedAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
@@ -172,7 +221,7 @@ func (s *UserStore) GetUserByID(ctx context.Context, id int64) (*User, error) {
 func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
 
 	query := `
-		SELECT u.id, u.email, u.password, u.email_verified_at, u.created_at, u.updated_at, role_id, r.name, r.description, r.level
+		SELECT u.id, u.email, u.username, u.display_name, u.bio, u.avatar_url, u.is_private, u.messages_followers_only, u.password, u.email_verified_at, u.created_at, u.updated_at, role_id, r.name, r.description, r.level
 		FROM users u
 		JOIN roles r ON u.role_id = r.id
 		WHERE email = $1 AND email_verified_at IS NOT NULL 
@@ -189,6 +238,12 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 	).Scan(
 		&user.ID,
 		&user.Email,
+		&user.Username,
+		&user.DisplayName,
+		&user.Bio,
+		&user.AvatarURL,
+		&user.IsPrivate,
+		&user.MessagesFollowersOnly,
 		&user.Password.Hash,
 		&user.EmailVerifiedAt,
 		&user.CreatedAt,
@@ -211,23 +266,152 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 	return user, err
 }
 
-func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration) error {
+// UserStats are the counters shown on a profile.
+type UserStats struct {
+	Followers int64 `json:"followers"`
+	Following int64 `json:"following"`
+	Posts     int64 `json:"posts"`
+}
+
+func (s *UserStore) GetStats(ctx context.Context, userID int64) (*UserStats, error) {
+
+	query := `
+		SELECT
+		    (SELECT COUNT(*) FROM followers WHERE user_id = $1),
+		    (SELECT COUNT(*) FROM followers WHERE follower_id = $1),
+		    (SELECT COUNT(*) FROM posts WHERE user_id = $1 AND status = 'published')
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	stats := &UserStats{}
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		userID,
+	).Scan(
+		&stats.Followers,
+		&stats.Following,
+		&stats.Posts,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+func (s *UserStore) GetByUsername(ctx context.Context, username string) (*User, error) {
+
+	query := `
+		SELECT id, username, display_name, bio, avatar_url, is_private, created_at, updated_at
+		FROM users
+		WHERE username = $1 AND email_verified_at IS NOT NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	user := &User{}
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		username,
+	).Scan(
+		&user.ID,
+		&user.Username,
+		&user.DisplayName,
+		&user.Bio,
+		&user.AvatarURL,
+		&user.IsPrivate,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+func (s *UserStore) UpdateProfile(ctx context.Context, user *User) error {
+
+	query := `
+		UPDATE users
+		SET username = $1, display_name = $2, bio = $3, avatar_url = $4, is_private = $5, messages_followers_only = $6, updated_at = NOW()
+		WHERE id = $7
+		RETURNING updated_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		user.Username,
+		user.DisplayName,
+		user.Bio,
+		user.AvatarURL,
+		user.IsPrivate,
+		user.MessagesFollowersOnly,
+		user.ID,
+	).Scan(
+		&user.UpdatedAt,
+	)
+
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) {
+			if pqErr.Code == "23505" && pqErr.Constraint == "users_username_key" {
+				return ErrDuplicateUsername
+			}
+		}
+
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateAndInvite stores the user together with its invitation. invite runs
+// last inside the same transaction, so if it fails (e.g. the activation email
+// could not be sent) the user is rolled back and can register again.
+func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration, invite func(*User) error) error {
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
 		if err := s.create(ctx, tx, user); err != nil {
 			return err
 		}
 
-		if err := s.createUserInvitation(ctx, tx, token, invitationExp, user.ID); err != nil {
+		if err := s.createUserInvitation(ctx, tx, token, invitationExp, user.ID, OTPPurposeActivation); err != nil {
 			return err
 		}
 
+		if invite != nil {
+			if err := invite(user); err != nil {
+				return err
+			}
+		}
+
 		return nil
 	})
 }
 
-func (s *UserStore) createUserInvitation(ctx context.Context, tx *sql.Tx, token string, exp time.Duration, userID int64) error {
+func (s *UserStore) createUserInvitation(ctx context.Context, tx *sql.Tx, token string, exp time.Duration, userID int64, purpose string) error {
 
-	query := `INSERT INTO one_time_passwords (token, user_id, expired_at) VALUES ($1, $2, $3)`
+	query := `INSERT INTO one_time_passwords (token, user_id, expired_at, purpose) VALUES ($1, $2, $3, $4)`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
@@ -238,6 +422,7 @@ func (s *UserStore) createUserInvitation(ctx context.Context, tx *sql.Tx, token
 		token,
 		userID,
 		time.Now().Add(exp),
+		purpose,
 	)
 	if err != nil {
 		return err
@@ -250,7 +435,10 @@ func (s *UserStore) Activate(ctx context.Context, token string) error {
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
 
 		// find the user the token belongs to
-		user, err := s.getUserFromInvitation(ctx, tx, token)
+		user, err := s.getUserFromInvitation(ctx, tx, token, OTPPurposeActivation)
+		if err != nil {
+			return err
+		}
 
 		//update the user
 		user.EmailVerifiedAt = sql.NullTime{
@@ -263,7 +451,7 @@ func (s *UserStore) Activate(ctx context.Context, token string) error {
 		}
 
 		//clear the invitation
-		if err := s.deleteUserInvitation(ctx, tx, user.ID); err != nil {
+		if err := s.deleteUserInvitation(ctx, tx, user.ID, OTPPurposeActivation); err != nil {
 			return err
 		}
 
@@ -271,13 +459,13 @@ func (s *UserStore) Activate(ctx context.Context, token string) error {
 	})
 }
 
-func (s *UserStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token string) (*User, error) {
+func (s *UserStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token string, purpose string) (*User, error) {
 
 	query := `
 			SELECT u.id, u.email, u.email_verified_at, u.created_at
 			FROM users u
 			JOIN one_time_passwords otp ON u.id = otp.user_id
-			WHERE otp.token = $1 AND otp.expired_at > $2
+			WHERE otp.token = $1 AND otp.expired_at > $2 AND otp.purpose = $3
 		`
 
 	hash := sha256.Sum256([]byte(token))
@@ -292,6 +480,7 @@ func (s *UserStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token
 		query,
 		hashToken,
 		time.Now(),
+		purpose,
 	).Scan(
 		&user.ID,
 		&user.Email,
@@ -311,10 +500,10 @@ func (s *UserStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token
 	return user, nil
 }
 
-func (s *UserStore) deleteUserInvitation(ctx context.Context, tx *sql.Tx, userID int64) error {
+func (s *UserStore) deleteUserInvitation(ctx context.Context, tx *sql.Tx, userID int64, purpose string) error {
 
 	query := `
-		DELETE FROM one_time_passwords WHERE user_id = $1
+		DELETE FROM one_time_passwords WHERE user_id = $1 AND purpose = $2
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -324,6 +513,180 @@ func (s *UserStore) deleteUserInvitation(ctx context.Context, tx *sql.Tx, userID
 		ctx,
 		query,
 		userID,
+		purpose,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ReissueInvitation replaces the activation token of a user who has not
+// verified their email yet and returns that user. The new token is sent
+// once it is committed, a failed send leaves the user to ask again.
+func (s *UserStore) ReissueInvitation(ctx context.Context, email string, token string, invitationExp time.Duration) (*User, error) {
+
+	var user *User
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+
+		var err error
+		user, err = s.getUnverifiedByEmail(ctx, tx, email)
+		if err != nil {
+			return err
+		}
+
+		if err := s.deleteUserInvitation(ctx, tx, user.ID, OTPPurposeActivation); err != nil {
+			return err
+		}
+
+		return s.createUserInvitation(ctx, tx, token, invitationExp, user.ID, OTPPurposeActivation)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *UserStore) getUnverifiedByEmail(ctx context.Context, tx *sql.Tx, email string) (*User, error) {
+
+	query := `
+		SELECT id, email, email_verified_at, created_at, updated_at
+		FROM users
+		WHERE email = $1 AND email_verified_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	user := &User{}
+	err := tx.QueryRowContext(
+		ctx,
+		query,
+		email,
+	).Scan(
+		&user.ID,
+		&user.Email,
+		&user.EmailVerifiedAt,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// DeleteExpiredInvitations removes every one time password past its expiry,
+// whatever its purpose, and returns how many were removed.
+func (s *UserStore) DeleteExpiredInvitations(ctx context.Context) (int64, error) {
+
+	query := `DELETE FROM one_time_passwords WHERE expired_at <= $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// DeleteUnverified removes accounts that were never activated within the
+// grace period, together with their pending one time passwords.
+func (s *UserStore) DeleteUnverified(ctx context.Context, gracePeriod time.Duration) (int64, error) {
+
+	query := `
+		WITH deleted AS (
+		    DELETE FROM users
+		    WHERE email_verified_at IS NULL AND created_at <= $1
+		    RETURNING id
+		), otp AS (
+		    DELETE FROM one_time_passwords WHERE user_id IN (SELECT id FROM deleted)
+		)
+		SELECT COUNT(*) FROM deleted
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var deleted int64
+	err := s.db.QueryRowContext(ctx, query, time.Now().Add(-gracePeriod)).Scan(&deleted)
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+// CreatePasswordReset replaces any pending reset token of the user with a
+// new one, so only the most recent email can be used.
+func (s *UserStore) CreatePasswordReset(ctx context.Context, user *User, token string, exp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.deleteUserInvitation(ctx, tx, user.ID, OTPPurposePasswordReset); err != nil {
+			return err
+		}
+
+		return s.createUserInvitation(ctx, tx, token, exp, user.ID, OTPPurposePasswordReset)
+	})
+}
+
+// ResetPassword sets a new password for the owner of the reset token and
+// revokes every session the user had, including the ones of whoever may
+// have learned the old password.
+func (s *UserStore) ResetPassword(ctx context.Context, token string, newPassword string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+
+		user, err := s.getUserFromInvitation(ctx, tx, token, OTPPurposePasswordReset)
+		if err != nil {
+			return err
+		}
+
+		if err := user.Password.Set(newPassword); err != nil {
+			return err
+		}
+
+		if err := s.updatePassword(ctx, tx, user); err != nil {
+			return err
+		}
+
+		if err := s.deleteUserInvitation(ctx, tx, user.ID, OTPPurposePasswordReset); err != nil {
+			return err
+		}
+
+		refreshTokens := &RefreshTokenStore{s.db}
+
+		return refreshTokens.revokeAllForUser(ctx, tx, user.ID)
+	})
+}
+
+func (s *UserStore) updatePassword(ctx context.Context, tx *sql.Tx, user *User) error {
+
+	query := `
+		UPDATE users
+		SET password = $1, updated_at = NOW()
+		WHERE id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(
+		ctx,
+		query,
+		user.Password.Hash,
+		user.ID,
 	)
 
 	if err != nil {
@@ -1,8 +1,9 @@
 package types
 
 type APIResponseBody struct {
-	Status  bool        `json:"status"`
-	Message string      `json:"message"`
-	Token   string      `json:"token,omitempty"`
-	Data    interface{} `json:"data,omitempty"`
+	Status       bool        `json:"status"`
+	Message      string      `json:"message"`
+	Token        string      `json:"token,omitempty"`
+	RefreshToken string      `json:"refresh_token,omitempty"`
+	Data         interface{} `json:"data,omitempty"`
 }
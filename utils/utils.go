@@ -7,10 +7,20 @@ import (
 	"github.com/go-playground/validator/v10"
 	"io"
 	"net/http"
+	"regexp"
 )
 
 var Validate = validator.New()
 
+var usernameRegex = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+func init() {
+	// usernames match the chk_users_username constraint
+	_ = Validate.RegisterValidation("username", func(fl validator.FieldLevel) bool {
+		return usernameRegex.MatchString(fl.Field().String())
+	})
+}
+
 func ParseJSON(w http.ResponseWriter, r *http.Request, payload any) error {
 
 	if r.Body == nil {